@@ -10,22 +10,58 @@ import (
 	"time"
 
 	"github.com/akhilesharora/turnaround-collector/internal/camera"
+	"github.com/akhilesharora/turnaround-collector/internal/health"
+	"github.com/akhilesharora/turnaround-collector/internal/tlsutil"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
 )
 
 func main() {
-	logger := log.New(os.Stdout, "CAMERA: ", log.LstdFlags)
+	logger, err := logging.FromEnv("camera")
+	if err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	}
 	server := camera.NewServer(logger)
+	auth, err := camera.AuthFromEnv()
+	if err != nil {
+		logging.Fatal(logger, "Invalid camera auth configuration", logging.KeyError, err)
+	}
+	if auth != nil {
+		server.SetAuth(*auth)
+		logger.Info("Snapshots require authentication", "scheme", auth.Scheme)
+	}
+
+	checker := health.NewChecker()
+	mux := http.NewServeMux()
+	checker.Register(mux)
+	mux.Handle("/", server)
 
 	srv := &http.Server{
 		Addr:    ":8080",
-		Handler: server,
+		Handler: mux,
+	}
+
+	tlsConfig, keypair, err := tlsutil.ServerFromEnv()
+	if err != nil {
+		logging.Fatal(logger, "Invalid TLS configuration", logging.KeyError, err)
+	}
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	if tlsConfig != nil {
+		srv.TLSConfig = tlsConfig
+		go keypair.Watch(watchCtx, tlsutil.DefaultReloadInterval, logger)
 	}
 
 	// Start camera server
 	go func() {
-		logger.Printf("Starting camera server on :8080")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatalf("Server failed: %v", err)
+		logger.Info("Starting camera server", "addr", srv.Addr, "tls", srv.TLSConfig != nil)
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logging.Fatal(logger, "Server failed", logging.KeyError, err)
 		}
 	}()
 
@@ -34,11 +70,11 @@ func main() {
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
-	logger.Println("Shutting down server...")
+	logger.Info("Shutting down server")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		logger.Printf("Error during shutdown: %v", err)
+		logger.Error("Error during shutdown", logging.KeyError, err)
 	}
 }
@@ -2,65 +2,263 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/akhilesharora/turnaround-collector/internal/admin"
 	"github.com/akhilesharora/turnaround-collector/internal/collector"
+	"github.com/akhilesharora/turnaround-collector/internal/config"
+	"github.com/akhilesharora/turnaround-collector/internal/health"
+	"github.com/akhilesharora/turnaround-collector/internal/metrics"
+	"github.com/akhilesharora/turnaround-collector/internal/spool"
+	"github.com/akhilesharora/turnaround-collector/internal/tlsutil"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
 )
 
 func main() {
-	logger := log.New(os.Stdout, "COLLECTOR: ", log.LstdFlags)
-
-	// Get configuration
-	cameraCount, err := strconv.Atoi(os.Getenv("CAMERA_COUNT"))
-	if err != nil || cameraCount < 1 {
-		cameraCount = 3
+	cfg, opts, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	// The merged config is printed even when invalid to help spot the culprit
+	if opts.printConfig {
+		printed := cfg
+		if printed.Admin.Token != "" {
+			printed.Admin.Token = "REDACTED"
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(printed)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	if opts.printConfig {
+		return
 	}
 
-	maxConcurrent, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT"))
-	if err != nil || maxConcurrent < 1 {
-		maxConcurrent = (cameraCount + 1) / 2
+	logger, err := cfg.Log.Logger("collector")
+	if err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
 	}
 
-	config := collector.Config{
-		CameraCount:   getEnvInt("CAMERA_COUNT", 3),
-		PollInterval:  getEnvDuration("POLL_INTERVAL", 5*time.Second),
-		MaxConcurrent: getEnvInt("MAX_CONCURRENT", 0),
-		CameraBaseURL: getEnv("CAMERA_BASE_URL", "http://camera"),
-		TargetURL:     getEnv("TARGET_URL", "http://target:8080/image"),
+	collectorConfig, err := cfg.Collector()
+	if err != nil {
+		logging.Fatal(logger, "Failed to load cameras", logging.KeyError, err)
 	}
 
 	httpClient := collector.NewClient(
-		5*time.Second,
-		config.CameraBaseURL,
-		config.TargetURL,
+		time.Duration(cfg.RequestTimeout),
+		collectorConfig.Cameras,
+		collectorConfig.TargetURL,
 	)
+	tlsConfig, clientCert, err := cfg.TLS.Build()
+	if err != nil {
+		logging.Fatal(logger, "Invalid TLS configuration", logging.KeyError, err)
+	}
+	if tlsConfig != nil {
+		httpClient.SetTLSConfig(tlsConfig)
+	}
+	signingKey, err := cfg.TargetAuth.Key()
+	if err != nil {
+		logging.Fatal(logger, "Invalid target auth configuration", logging.KeyError, err)
+	}
+	if signingKey != nil {
+		httpClient.SetSigningKey(*signingKey)
+	}
+	httpClient.SetMaxResponseBytes(cfg.MaxImageBytes)
+	if cfg.ImageValidation.Enabled {
+		httpClient.SetImageValidation(cfg.ImageValidation.Limits())
+	}
 
-	c := collector.NewCollector(
-		config,
-		httpClient,
-		httpClient,
+	retryPolicy := cfg.Retry.Policy()
+	breakerConfig := cfg.Breaker.Breaker()
+
+	// Breakers wrap the retries so an open circuit fails fast without backoff
+	fetcher := collector.NewBreakerFetcher(
+		collector.NewRetryFetcher(httpClient, retryPolicy, logger),
+		breakerConfig,
+		logger,
+	)
+	targetBreaker := collector.NewBreakerSender(
+		collector.NewRetrySender(httpClient, retryPolicy, logger),
+		"target "+collectorConfig.TargetURL,
+		breakerConfig,
 		logger,
 	)
+	var sender interfaces.ImageSender = targetBreaker
+	targetBreakers := map[string]*collector.BreakerSender{collectorConfig.TargetURL: targetBreaker}
+	if len(cfg.Targets) > 0 {
+		// Each target gets its own retries and breaker so one failing sink
+		// does not trip the others
+		var targets []collector.Target
+		targetBreakers = make(map[string]*collector.BreakerSender, len(cfg.Targets))
+		for _, t := range cfg.Targets {
+			breaker := collector.NewBreakerSender(
+				collector.NewRetrySender(httpClient.Target(t.URL), retryPolicy, logger),
+				"target "+t.Name,
+				breakerConfig,
+				logger,
+			)
+			targetBreakers[t.Name] = breaker
+			targets = append(targets, collector.Target{
+				Name:        t.Name,
+				Sender:      breaker,
+				Delivery:    t.Delivery,
+				Route:       t.Route(),
+				MaxInFlight: t.MaxInFlight,
+			})
+			logger.Info("Sending to target", "target", t.Name, "url", t.URL)
+		}
+		sender = collector.NewMultiSender(targets, collectorConfig.Cameras, logger)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
+	var imageSender interfaces.ImageSender = sender
+	if dir := cfg.Spool.Dir; dir != "" {
+		sp, err := spool.Open(dir, cfg.Spool.Options())
+		if err != nil {
+			logging.Fatal(logger, "Failed to open spool", logging.KeyError, err)
+		}
+		defer sp.Close()
+
+		spoolSender := collector.NewSpoolSender(sp, sender, logger)
+		go spoolSender.Run(ctx)
+		metrics.Default.NewGaugeFunc("collector_spool_bytes", "On-disk size of the spool.", func() float64 {
+			return float64(spoolSender.Stats().Bytes)
+		})
+		metrics.Default.NewGaugeFunc("collector_spool_pending_bytes", "Spooled bytes not yet delivered.", func() float64 {
+			return float64(spoolSender.Stats().Pending)
+		})
+		imageSender = spoolSender
+		logger.Info("Spooling images", "dir", dir)
+	}
+
+	c := collector.NewCollector(
+		collectorConfig,
+		fetcher,
+		imageSender,
+		logger,
+	)
+	if cfg.Stream {
+		c.SetStreamer(httpClient)
+		logger.Info("Streaming images from cameras to the target without buffering")
+	}
+
+	// Ready once the target accepted an image and while recent frames mostly succeed
+	checker := health.NewChecker()
+	checker.AddReadinessCheck("target", func() error {
+		if !httpClient.TargetReached() {
+			return errors.New("target not reached yet")
+		}
+		return nil
+	})
+	checker.AddReadinessCheck("success_rate", c.SuccessRate().Check(
+		cfg.Admin.ReadySuccessThreshold,
+		cfg.Admin.ReadyMinSamples,
+	))
+
+	// Admin server exposing metrics and health checks
+	var adminServer *http.Server
+	if addr := cfg.Admin.Addr; addr != "" {
+		mux := http.NewServeMux()
+		checker.Register(mux)
+		mux.Handle("/metrics", metrics.Default.Handler())
+		if cfg.Admin.Token != "" {
+			api := admin.NewAPI(c, cfg.Admin.Token, logger)
+			api.SetBreakers(fetcher, targetBreakers)
+			api.Register(mux)
+		} else {
+			logger.Info("Camera management API disabled; set ADMIN_TOKEN to enable it")
+		}
+		adminServer = &http.Server{
+			Addr:    addr,
+			Handler: mux,
+		}
+		go func() {
+			logger.Info("Starting admin server", "addr", addr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logging.Fatal(logger, "Admin server failed", logging.KeyError, err)
+			}
+		}()
+	}
+
 	// Start collector
 	errCh := make(chan error, 1)
 	go func() {
 		errCh <- c.Start(ctx)
 	}()
 
+	// Reload on SIGHUP and whenever the config file changes
+	reloadCh := make(chan struct{}, 1)
+	requestReload := func() {
+		select {
+		case reloadCh <- struct{}{}:
+		default:
+		}
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			requestReload()
+		}
+	}()
+	if opts.configFile != "" && opts.watchInterval > 0 {
+		go config.Watch(ctx, opts.configFile, opts.watchInterval, requestReload)
+	}
+	// Rotated client certificates apply to new connections without a reload
+	if clientCert != nil {
+		go clientCert.Watch(ctx, tlsutil.DefaultReloadInterval, logger)
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-reloadCh:
+			}
+
+			next, _, err := loadConfig(os.Args[1:])
+			if err == nil {
+				err = next.Validate()
+			}
+			var nextConfig collector.Config
+			if err == nil {
+				nextConfig, err = next.Collector()
+			}
+			if err != nil {
+				logger.Error("Rejected configuration reload; keeping the current configuration", logging.KeyError, err)
+				continue
+			}
+
+			if changed := cfg.RestartRequired(next); len(changed) > 0 {
+				logger.Warn("Some configuration changes only take effect after a restart", "settings", changed)
+			}
+			httpClient.SetTargetURL(nextConfig.TargetURL)
+			c.Reload(nextConfig)
+			cfg = next
+			logger.Info("Configuration reloaded")
+		}
+	}()
+
 	// Wait for interrupt
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
-	logger.Println("Shutting down collector...")
+	logger.Info("Shutting down collector")
 	cancel()
 
 	// Wait for collector to finish with timeout
@@ -70,35 +268,49 @@ func main() {
 	select {
 	case err := <-errCh:
 		if err != nil && err != context.Canceled {
-			logger.Printf("Error during shutdown: %v", err)
+			logger.Error("Error during shutdown", logging.KeyError, err)
 		}
 	case <-shutdownCtx.Done():
-		logger.Printf("Shutdown timed out")
+		logger.Warn("Shutdown timed out")
 	}
-}
 
-// Helper functions
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Error during admin server shutdown", logging.KeyError, err)
+		}
 	}
-	return fallback
 }
 
-func getEnvInt(key string, fallback int) int {
-	if str, exists := os.LookupEnv(key); exists {
-		if value, err := strconv.Atoi(str); err == nil {
-			return value
+// loadConfig merges the defaults, the config file (-config or CONFIG_FILE),
+// environment variables and flags.
+func loadConfig(args []string) (config.Config, options, error) {
+	var opts options
+	fs := flag.NewFlagSet("collector", flag.ExitOnError)
+	fs.StringVar(&opts.configFile, "config", os.Getenv("CONFIG_FILE"), "JSON config file (env CONFIG_FILE)")
+	fs.BoolVar(&opts.printConfig, "print-config", false, "print the effective configuration and exit")
+	fs.DurationVar(&opts.watchInterval, "config-watch-interval", 5*time.Second, "how often the config file is checked for changes (0 disables)")
+	overrides := config.RegisterFlags(fs)
+	fs.Parse(args)
+
+	cfg := config.Default()
+	if opts.configFile != "" {
+		var err error
+		if cfg, err = config.Load(opts.configFile); err != nil {
+			return cfg, opts, err
 		}
 	}
-	return fallback
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return cfg, opts, err
+	}
+	if err := overrides.Apply(&cfg); err != nil {
+		return cfg, opts, err
+	}
+	return cfg, opts, nil
 }
 
-func getEnvDuration(key string, fallback time.Duration) time.Duration {
-	if str, exists := os.LookupEnv(key); exists {
-		if value, err := time.ParseDuration(str); err == nil {
-			return value
-		}
-	}
-	return fallback
+// options are command-line flags that are not part of the configuration.
+type options struct {
+	configFile    string
+	printConfig   bool
+	watchInterval time.Duration
 }
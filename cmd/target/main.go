@@ -6,26 +6,157 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/akhilesharora/turnaround-collector/internal/config"
+	"github.com/akhilesharora/turnaround-collector/internal/health"
+	"github.com/akhilesharora/turnaround-collector/internal/index"
+	"github.com/akhilesharora/turnaround-collector/internal/retention"
+	"github.com/akhilesharora/turnaround-collector/internal/signing"
+	"github.com/akhilesharora/turnaround-collector/internal/storage"
 	"github.com/akhilesharora/turnaround-collector/internal/target"
+	"github.com/akhilesharora/turnaround-collector/internal/tlsutil"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
 )
 
 func main() {
-	logger := log.New(os.Stdout, "TARGET: ", log.LstdFlags)
-	server := target.NewServer(logger, nil)
+	logger, err := logging.FromEnv("target")
+	if err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	}
+	var processor interfaces.ImageProcessor
+	var imagesAPI *target.ImagesAPI
+	var retentionManager *retention.Manager
+	retentionInterval := 10 * time.Minute
+	if dir := os.Getenv("STORAGE_DIR"); dir != "" {
+		store, err := storage.NewFileStore(dir)
+		if err != nil {
+			logging.Fatal(logger, "Failed to open image storage", logging.KeyError, err)
+		}
+		// Camera directories never start with a dot
+		idx, err := index.Open(filepath.Join(dir, ".index", "images.log"))
+		if err != nil {
+			logging.Fatal(logger, "Failed to open image index", logging.KeyError, err)
+		}
+		defer idx.Close()
+		storeProcessor := target.NewStoreProcessor(store, logger)
+		storeProcessor.SetIndex(idx)
+		processor = storeProcessor
+		if token := os.Getenv("IMAGES_TOKEN"); token != "" {
+			imagesAPI = target.NewImagesAPI(idx, store, token, logger)
+		}
+		logger.Info("Storing images", "dir", dir, "indexed", idx.Len())
+
+		if path := os.Getenv("RETENTION_FILE"); path != "" {
+			policy, err := retention.LoadPolicy(path)
+			if err != nil {
+				logging.Fatal(logger, "Invalid retention policy", logging.KeyError, err)
+			}
+			if v := os.Getenv("RETENTION_INTERVAL"); v != "" {
+				retentionInterval, err = time.ParseDuration(v)
+				if err != nil || retentionInterval <= 0 {
+					logging.Fatal(logger, "Invalid RETENTION_INTERVAL", "value", v)
+				}
+			}
+			retentionManager = retention.NewManager(idx, store, policy, logger)
+			retentionManager.SetDryRun(os.Getenv("RETENTION_DRY_RUN") == "true")
+		}
+	}
+	server := target.NewServer(logger, processor)
+	if v := os.Getenv("MAX_IMAGE_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			logging.Fatal(logger, "Invalid MAX_IMAGE_BYTES", "value", v, logging.KeyError, err)
+		}
+		server.SetMaxImageBytes(n)
+	}
+	if v := os.Getenv("QUEUE_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 1 {
+			logging.Fatal(logger, "Invalid QUEUE_SIZE", "value", v)
+		}
+		workers := 4
+		if v := os.Getenv("QUEUE_WORKERS"); v != "" {
+			workers, err = strconv.Atoi(v)
+			if err != nil || workers < 1 {
+				logging.Fatal(logger, "Invalid QUEUE_WORKERS", "value", v)
+			}
+		}
+		server.SetQueue(size, workers)
+		logger.Info("Processing images in the background", "queue_size", size, "workers", workers)
+	}
+	if v := os.Getenv("SIGNATURE_MAX_SKEW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			logging.Fatal(logger, "Invalid SIGNATURE_MAX_SKEW", "value", v)
+		}
+		server.SetMaxSkew(d)
+	}
+	keysFile := os.Getenv("API_KEYS_FILE")
+	if keysFile != "" {
+		keys, err := signing.LoadKeys(keysFile)
+		if err != nil {
+			logging.Fatal(logger, "Failed to load API keys", logging.KeyError, err)
+		}
+		server.SetKeys(keys)
+		logger.Info("Requiring signed deliveries", "keys", len(keys))
+	}
+
+	checker := health.NewChecker()
+	checker.AddReadinessCheck("processor", server.Ready)
+	mux := http.NewServeMux()
+	checker.Register(mux)
+	if imagesAPI != nil {
+		imagesAPI.Register(mux)
+	}
+	mux.Handle("/", server)
 
 	srv := &http.Server{
 		Addr:    ":8080",
-		Handler: server,
+		Handler: mux,
+	}
+
+	tlsConfig, keypair, err := tlsutil.ServerFromEnv()
+	if err != nil {
+		logging.Fatal(logger, "Invalid TLS configuration", logging.KeyError, err)
+	}
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	if tlsConfig != nil {
+		srv.TLSConfig = tlsConfig
+		go keypair.Watch(watchCtx, tlsutil.DefaultReloadInterval, logger)
+	}
+	if retentionManager != nil {
+		go retentionManager.Run(watchCtx, retentionInterval)
+	}
+	if keysFile != "" {
+		// Keys are rotated by editing the file; a broken edit keeps the old ones
+		go config.Watch(watchCtx, keysFile, 5*time.Second, func() {
+			keys, err := signing.LoadKeys(keysFile)
+			if err != nil {
+				logger.Error("Failed to reload API keys; keeping the current ones", logging.KeyError, err)
+				return
+			}
+			server.SetKeys(keys)
+			logger.Info("Reloaded API keys", "keys", len(keys))
+		})
 	}
 
 	// Start target server
 	go func() {
-		logger.Printf("Starting target server on :8080")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatalf("Server failed: %v", err)
+		logger.Info("Starting target server", "addr", srv.Addr, "tls", srv.TLSConfig != nil)
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logging.Fatal(logger, "Server failed", logging.KeyError, err)
 		}
 	}()
 
@@ -34,11 +165,15 @@ func main() {
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
-	logger.Println("Shutting down server...")
+	logger.Info("Shutting down server")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		logger.Printf("Error during shutdown: %v", err)
+		logger.Error("Error during shutdown", logging.KeyError, err)
+	}
+	// Frames already accepted are processed before exiting
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("Queued images were not all processed", logging.KeyError, err)
 	}
 }
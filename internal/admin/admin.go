@@ -0,0 +1,204 @@
+// Package admin exposes the collector's runtime camera controls over HTTP.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/collector"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+// API serves the camera endpoints. Every request must carry the bearer token.
+type API struct {
+	collector *collector.Collector
+	token     string
+	logger    interfaces.Logger
+
+	cameraBreakers *collector.BreakerFetcher
+	targetBreakers map[string]*collector.BreakerSender
+}
+
+func NewAPI(c *collector.Collector, token string, logger interfaces.Logger) *API {
+	return &API{
+		collector: c,
+		token:     token,
+		logger:    logger,
+	}
+}
+
+// SetBreakers makes GET /breakers report the circuit breakers of the
+// cameras and of each target by name. It must be called before Register.
+func (a *API) SetBreakers(cameras *collector.BreakerFetcher, targets map[string]*collector.BreakerSender) {
+	a.cameraBreakers = cameras
+	a.targetBreakers = targets
+}
+
+// Register mounts the camera endpoints on mux.
+func (a *API) Register(mux *http.ServeMux) {
+	mux.Handle("GET /breakers", a.auth(a.listBreakers))
+	mux.Handle("GET /cameras", a.auth(a.listCameras))
+	mux.Handle("POST /cameras", a.auth(a.addCamera))
+	mux.Handle("GET /cameras/{id}", a.auth(a.getCamera))
+	mux.Handle("DELETE /cameras/{id}", a.auth(a.removeCamera))
+	mux.Handle("POST /cameras/{id}/pause", a.auth(a.pauseCamera))
+	mux.Handle("POST /cameras/{id}/resume", a.auth(a.resumeCamera))
+	mux.Handle("POST /cameras/{id}/capture", a.auth(a.captureCamera))
+	mux.Handle("PUT /cameras/{id}/poll-interval", a.auth(a.setPollInterval))
+}
+
+func (a *API) auth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="collector-admin"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (a *API) listCameras(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.collector.Cameras())
+}
+
+// listBreakers reports breaker states; cameras show up once first polled.
+func (a *API) listBreakers(w http.ResponseWriter, r *http.Request) {
+	status := struct {
+		Cameras map[string]collector.BreakerState `json:"cameras"`
+		Targets map[string]collector.BreakerState `json:"targets"`
+	}{
+		Cameras: map[string]collector.BreakerState{},
+		Targets: make(map[string]collector.BreakerState, len(a.targetBreakers)),
+	}
+	if a.cameraBreakers != nil {
+		status.Cameras = a.cameraBreakers.States()
+	}
+	for name, sender := range a.targetBreakers {
+		status.Targets[name] = sender.State()
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (a *API) getCamera(w http.ResponseWriter, r *http.Request) {
+	a.writeCamera(w, r.PathValue("id"), http.StatusOK)
+}
+
+func (a *API) addCamera(w http.ResponseWriter, r *http.Request) {
+	var cam collector.CameraConfig
+	if err := decodeJSON(r, &cam); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// Auth names files and environment variables to read secrets from,
+	// which API callers must not choose; cameras added here use the
+	// collector-wide camera auth
+	if cam.Auth != nil {
+		writeError(w, http.StatusBadRequest, errors.New("auth cannot be set through the API; configure it in the camera registry"))
+		return
+	}
+	if err := a.collector.AddCamera(cam); err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	a.writeCamera(w, cam.ID, http.StatusCreated)
+}
+
+func (a *API) removeCamera(w http.ResponseWriter, r *http.Request) {
+	if err := a.collector.RemoveCamera(r.PathValue("id")); err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) pauseCamera(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := a.collector.Pause(id); err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	a.writeCamera(w, id, http.StatusOK)
+}
+
+func (a *API) resumeCamera(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := a.collector.Resume(id); err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	a.writeCamera(w, id, http.StatusOK)
+}
+
+func (a *API) captureCamera(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := a.collector.Capture(r.Context(), id); err != nil {
+		if errors.Is(err, collector.ErrUnknownCamera) {
+			a.fail(w, r, err)
+			return
+		}
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	a.writeCamera(w, id, http.StatusOK)
+}
+
+func (a *API) setPollInterval(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		PollInterval collector.Duration `json:"poll_interval"`
+	}
+	if err := decodeJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	id := r.PathValue("id")
+	if err := a.collector.SetPollInterval(id, time.Duration(body.PollInterval)); err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	a.writeCamera(w, id, http.StatusOK)
+}
+
+func (a *API) writeCamera(w http.ResponseWriter, id string, status int) {
+	cam, err := a.collector.Camera(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, status, cam)
+}
+
+// fail maps collector errors to HTTP statuses.
+func (a *API) fail(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, collector.ErrUnknownCamera):
+		status = http.StatusNotFound
+	case errors.Is(err, collector.ErrDuplicateCamera):
+		status = http.StatusConflict
+	}
+	a.logger.Warn("Admin request failed", "method", r.Method, "path", r.URL.Path, logging.KeyError, err)
+	writeError(w, status, err)
+}
+
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,252 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/collector"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	testutil "github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+type stubFetcher struct{}
+
+func (stubFetcher) FetchImage(ctx context.Context, cameraID string) ([]byte, error) {
+	if cameraID == "camera_2" {
+		return nil, errors.New("connection refused")
+	}
+	return []byte("test image"), nil
+}
+
+type stubSender struct{}
+
+func (stubSender) SendImage(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+	return nil
+}
+
+const testToken = "s3cret"
+
+func TestAPI(t *testing.T) {
+	logger := &testutil.MockLogger{}
+	breakerConfig := collector.BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour}
+	fetcher := collector.NewBreakerFetcher(stubFetcher{}, breakerConfig, logger)
+	sender := collector.NewBreakerSender(stubSender{}, "target main", breakerConfig, logger)
+	c := collector.NewCollector(collector.Config{
+		PollInterval: time.Hour,
+		Cameras:      collector.DefaultRegistry(2, "http://camera"),
+	}, fetcher, sender, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	for !c.Cameras()[0].Polling {
+		time.Sleep(time.Millisecond)
+	}
+
+	mux := http.NewServeMux()
+	api := NewAPI(c, testToken, logger)
+	api.SetBreakers(fetcher, map[string]*collector.BreakerSender{"main": sender})
+	api.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "missing token",
+			method:         http.MethodGet,
+			path:           "/cameras",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong token",
+			method:         http.MethodGet,
+			path:           "/cameras",
+			token:          "guess",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "list cameras",
+			method:         http.MethodGet,
+			path:           "/cameras",
+			token:          testToken,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"id":"camera_2"`,
+		},
+		{
+			name:           "pause camera",
+			method:         http.MethodPost,
+			path:           "/cameras/camera_1/pause",
+			token:          testToken,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"paused":true,"polling":false`,
+		},
+		{
+			name:           "resume camera",
+			method:         http.MethodPost,
+			path:           "/cameras/camera_1/resume",
+			token:          testToken,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"paused":false,"polling":true`,
+		},
+		{
+			name:           "capture records success",
+			method:         http.MethodPost,
+			path:           "/cameras/camera_1/capture",
+			token:          testToken,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"last_success":`,
+		},
+		{
+			name:           "failed capture",
+			method:         http.MethodPost,
+			path:           "/cameras/camera_2/capture",
+			token:          testToken,
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   "connection refused",
+		},
+		{
+			name:           "breaker states",
+			method:         http.MethodGet,
+			path:           "/breakers",
+			token:          testToken,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"cameras":{"camera_1":"closed","camera_2":"open"},"targets":{"main":"closed"}}`,
+		},
+		{
+			name:           "failure shows in status",
+			method:         http.MethodGet,
+			path:           "/cameras/camera_2",
+			token:          testToken,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"consecutive_failures":1`,
+		},
+		{
+			name:           "set poll interval",
+			method:         http.MethodPut,
+			path:           "/cameras/camera_1/poll-interval",
+			token:          testToken,
+			body:           `{"poll_interval": "30s"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"poll_interval":"30s"`,
+		},
+		{
+			name:           "invalid poll interval",
+			method:         http.MethodPut,
+			path:           "/cameras/camera_1/poll-interval",
+			token:          testToken,
+			body:           `{"poll_interval": "-1s"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "must not be negative",
+		},
+		{
+			name:           "add camera",
+			method:         http.MethodPost,
+			path:           "/cameras",
+			token:          testToken,
+			body:           `{"id": "dock_3", "url": "http://dock-3"}`,
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `"polling":true`,
+		},
+		{
+			name:           "add duplicate camera",
+			method:         http.MethodPost,
+			path:           "/cameras",
+			token:          testToken,
+			body:           `{"id": "dock_3", "url": "http://dock-3"}`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "add invalid camera",
+			method:         http.MethodPost,
+			path:           "/cameras",
+			token:          testToken,
+			body:           `{"id": "dock_4", "url": "ftp://dock-4"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "add camera with auth",
+			method:         http.MethodPost,
+			path:           "/cameras",
+			token:          testToken,
+			body:           `{"id": "dock_5", "url": "http://dock-5", "auth": {"scheme": "bearer", "secret_file": "/etc/target-key.secret"}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "auth cannot be set through the API",
+		},
+		{
+			name:           "remove camera",
+			method:         http.MethodDelete,
+			path:           "/cameras/dock_3",
+			token:          testToken,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "unknown camera",
+			method:         http.MethodPost,
+			path:           "/cameras/dock_3/pause",
+			token:          testToken,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, resp.StatusCode, body)
+			}
+			if !strings.Contains(string(body), tt.expectedBody) {
+				t.Errorf("expected body containing %q, got %s", tt.expectedBody, body)
+			}
+		})
+	}
+
+	var statuses []collector.CameraStatus
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/cameras", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 {
+		t.Errorf("expected the added camera to be removed again, got %+v", statuses)
+	}
+}
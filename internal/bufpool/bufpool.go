@@ -0,0 +1,95 @@
+// Package bufpool reuses image buffers across frames instead of allocating
+// one per request.
+//
+// Buffers come in size classes growing by 4x from 16 KiB to 16 MiB, so a
+// camera's frames keep landing in the same class. Larger buffers are not
+// pooled. A buffer handed to Put must not be used afterwards; buffers that
+// did not come from Get can be put as well.
+package bufpool
+
+import (
+	"io"
+	"sync"
+)
+
+const (
+	minSize    = 16 << 10
+	maxSize    = 16 << 20
+	classCount = 6
+)
+
+var pools [classCount]sync.Pool
+
+// class returns the smallest class holding size bytes, or -1 if size is
+// too large to be pooled.
+func class(size int) int {
+	c, n := 0, minSize
+	for n < size {
+		if n >= maxSize {
+			return -1
+		}
+		c, n = c+1, n*4
+	}
+	return c
+}
+
+func classSize(c int) int {
+	return minSize << (2 * c)
+}
+
+// Get returns an empty buffer with room for at least size bytes.
+func Get(size int) []byte {
+	c := class(size)
+	if c < 0 {
+		return make([]byte, 0, size)
+	}
+	if p, ok := pools[c].Get().(*[]byte); ok {
+		return (*p)[:0]
+	}
+	return make([]byte, 0, classSize(c))
+}
+
+// Put returns b to the pool of the largest class it can serve.
+func Put(b []byte) {
+	if cap(b) < minSize {
+		return
+	}
+	c := class(cap(b))
+	if c < 0 {
+		return
+	}
+	if classSize(c) > cap(b) {
+		c--
+	}
+	b = b[:0]
+	pools[c].Put(&b)
+}
+
+// ReadAll reads r until EOF into a pooled buffer, which the caller puts
+// back once done with it. sizeHint, when known, is the expected length; it
+// saves growing the buffer. On error the buffer is put back right away.
+func ReadAll(r io.Reader, sizeHint int64) ([]byte, error) {
+	size := minSize
+	if sizeHint > 0 && sizeHint < maxSize {
+		// One byte extra lets the read that returns EOF fit without growing
+		size = int(sizeHint) + 1
+	}
+	b := Get(size)
+	for {
+		if len(b) == cap(b) {
+			grown := Get(2 * cap(b))
+			grown = append(grown, b...)
+			Put(b)
+			b = grown
+		}
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			Put(b)
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package bufpool
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestClass(t *testing.T) {
+	tests := []struct {
+		size     int
+		expected int
+	}{
+		{size: 0, expected: 0},
+		{size: minSize, expected: 0},
+		{size: minSize + 1, expected: 1},
+		{size: 1 << 20, expected: 3},
+		{size: maxSize, expected: classCount - 1},
+		{size: maxSize + 1, expected: -1},
+	}
+
+	for _, tt := range tests {
+		if got := class(tt.size); got != tt.expected {
+			t.Errorf("class(%d): expected %d, got %d", tt.size, tt.expected, got)
+		}
+	}
+}
+
+func TestGetPut(t *testing.T) {
+	b := Get(100 << 10)
+	if len(b) != 0 || cap(b) < 100<<10 {
+		t.Fatalf("expected an empty buffer for 100 KiB, got len %d cap %d", len(b), cap(b))
+	}
+	Put(append(b, 1, 2, 3))
+
+	// Whatever comes back must be empty and large enough
+	if b := Get(200 << 10); len(b) != 0 || cap(b) < 200<<10 {
+		t.Errorf("expected an empty buffer for 200 KiB, got len %d cap %d", len(b), cap(b))
+	}
+	if b := Get(maxSize + 1); cap(b) < maxSize+1 {
+		t.Errorf("expected an unpooled buffer of %d bytes, got cap %d", maxSize+1, cap(b))
+	}
+
+	// Buffers that do not fill a class are filed under the one below
+	Put(make([]byte, 0, minSize))
+	Put(make([]byte, 10))
+}
+
+func TestReadAll(t *testing.T) {
+	data := bytes.Repeat([]byte("frame"), 30<<10)
+
+	tests := []struct {
+		name     string
+		reader   io.Reader
+		sizeHint int64
+	}{
+		{name: "exact hint", reader: bytes.NewReader(data), sizeHint: int64(len(data))},
+		{name: "no hint", reader: bytes.NewReader(data)},
+		{name: "small hint", reader: bytes.NewReader(data), sizeHint: 10},
+		{name: "one byte at a time", reader: iotest.OneByteReader(bytes.NewReader(data))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadAll(tt.reader, tt.sizeHint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("expected %d bytes read back, got %d", len(data), len(got))
+			}
+			Put(got)
+		})
+	}
+
+	boom := errors.New("boom")
+	if _, err := ReadAll(iotest.ErrReader(boom), 0); !errors.Is(err, boom) {
+		t.Errorf("expected the read error, got %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package camera
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/httpauth"
+)
+
+const (
+	authRealm = "turnaround-camera"
+	// nonceLifetime is how long a digest nonce is accepted before clients
+	// are told it went stale.
+	nonceLifetime = 5 * time.Minute
+)
+
+// Auth makes the simulated camera demand credentials like a real one.
+type Auth struct {
+	// Scheme is basic, digest or bearer.
+	Scheme   string
+	Username string
+	// Secret is the password, or the token for bearer.
+	Secret string
+}
+
+// AuthFromEnv reads CAMERA_AUTH_SCHEME, CAMERA_AUTH_USERNAME and the secret
+// from CAMERA_AUTH_SECRET or the file named by CAMERA_AUTH_SECRET_FILE. It
+// returns nil when no scheme is set.
+func AuthFromEnv() (*Auth, error) {
+	a := &Auth{Scheme: os.Getenv("CAMERA_AUTH_SCHEME"), Username: os.Getenv("CAMERA_AUTH_USERNAME")}
+	if a.Scheme == "" {
+		return nil, nil
+	}
+	a.Secret = os.Getenv("CAMERA_AUTH_SECRET")
+	if path := os.Getenv("CAMERA_AUTH_SECRET_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read CAMERA_AUTH_SECRET_FILE: %w", err)
+		}
+		a.Secret = strings.TrimSpace(string(data))
+	}
+	switch a.Scheme {
+	case "basic", "digest", "bearer":
+	default:
+		return nil, fmt.Errorf("unknown CAMERA_AUTH_SCHEME %q (want basic, digest or bearer)", a.Scheme)
+	}
+	if a.Secret == "" {
+		return nil, fmt.Errorf("%s auth requires CAMERA_AUTH_SECRET or CAMERA_AUTH_SECRET_FILE", a.Scheme)
+	}
+	return a, nil
+}
+
+// authenticator checks the credentials of snapshot requests.
+type authenticator struct {
+	Auth
+
+	mu       sync.Mutex
+	lifetime time.Duration
+	// nonces maps the digest nonces handed out to when they were issued
+	// and the highest nonce count seen, which must keep increasing.
+	nonces map[string]*nonceState
+}
+
+type nonceState struct {
+	issued time.Time
+	nc     uint64
+}
+
+func newAuthenticator(a Auth) *authenticator {
+	return &authenticator{Auth: a, lifetime: nonceLifetime, nonces: make(map[string]*nonceState)}
+}
+
+// check reports whether r carries valid credentials. If not, it answers
+// with 401 and the challenges for the scheme.
+func (a *authenticator) check(w http.ResponseWriter, r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	switch a.Scheme {
+	case "basic":
+		user, password, ok := r.BasicAuth()
+		if ok && equal(user, a.Username) && equal(password, a.Secret) {
+			return true
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q`, authRealm))
+	case "bearer":
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if ok && equal(token, a.Secret) {
+			return true
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, authRealm))
+	case "digest":
+		ok, stale := a.checkDigest(r, header)
+		if ok {
+			return true
+		}
+		// Offer the strongest algorithm first; legacy clients fall back to MD5
+		nonce := a.issueNonce()
+		for _, algorithm := range []string{httpauth.SHA256, httpauth.MD5} {
+			w.Header().Add("WWW-Authenticate", httpauth.Challenge{
+				Realm:     authRealm,
+				Nonce:     nonce,
+				Algorithm: algorithm,
+				QOP:       []string{"auth"},
+				Stale:     stale,
+			}.String())
+		}
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// checkDigest verifies digest credentials. stale is set when they were
+// right but the nonce has expired, so the client can retry without asking
+// for the password again.
+func (a *authenticator) checkDigest(r *http.Request, header string) (ok, stale bool) {
+	creds, ok := httpauth.ParseCredentials(header)
+	if !ok || !equal(creds.Username, a.Username) || creds.Realm != authRealm || creds.URI != r.URL.RequestURI() {
+		return false, false
+	}
+	if expected := creds.Expected(a.Secret, r.Method); expected == "" || !equal(creds.Response, expected) {
+		return false, false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	state, known := a.nonces[creds.Nonce]
+	if !known || time.Since(state.issued) > a.lifetime {
+		return false, true
+	}
+	if creds.QOP != "" {
+		// A replayed or reordered nonce count is rejected
+		nc, err := strconv.ParseUint(creds.NC, 16, 64)
+		if err != nil || nc <= state.nc {
+			return false, false
+		}
+		state.nc = nc
+	}
+	return true, false
+}
+
+func (a *authenticator) issueNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	nonce := hex.EncodeToString(b)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for n, state := range a.nonces {
+		if time.Since(state.issued) > a.lifetime {
+			delete(a.nonces, n)
+		}
+	}
+	a.nonces[nonce] = &nonceState{issued: time.Now()}
+	return nonce
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
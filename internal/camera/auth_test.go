@@ -0,0 +1,129 @@
+package camera
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/akhilesharora/turnaround-collector/internal/httpauth"
+	testutil "github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+func TestCameraServerAuth(t *testing.T) {
+	tests := []struct {
+		name           string
+		auth           Auth
+		authorize      func(r *http.Request)
+		expectedStatus int
+		expectedScheme string
+	}{
+		{
+			name:           "basic",
+			auth:           Auth{Scheme: "basic", Username: "admin", Secret: "s3cret"},
+			authorize:      func(r *http.Request) { r.SetBasicAuth("admin", "s3cret") },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "basic with wrong password",
+			auth:           Auth{Scheme: "basic", Username: "admin", Secret: "s3cret"},
+			authorize:      func(r *http.Request) { r.SetBasicAuth("admin", "guess") },
+			expectedStatus: http.StatusUnauthorized,
+			expectedScheme: "Basic",
+		},
+		{
+			name:           "bearer",
+			auth:           Auth{Scheme: "bearer", Secret: "token"},
+			authorize:      func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing bearer token",
+			auth:           Auth{Scheme: "bearer", Secret: "token"},
+			authorize:      func(r *http.Request) {},
+			expectedStatus: http.StatusUnauthorized,
+			expectedScheme: "Bearer",
+		},
+		{
+			name:           "digest without credentials",
+			auth:           Auth{Scheme: "digest", Username: "admin", Secret: "s3cret"},
+			authorize:      func(r *http.Request) {},
+			expectedStatus: http.StatusUnauthorized,
+			expectedScheme: "Digest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(&testutil.MockLogger{})
+			server.SetAuth(tt.auth)
+
+			req := httptest.NewRequest(http.MethodGet, "/snap.jpg", nil)
+			req.Header.Set("X-Camera-ID", "camera_1")
+			tt.authorize(req)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedScheme != "" {
+				if got := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, tt.expectedScheme+" ") {
+					t.Errorf("expected a %s challenge, got %q", tt.expectedScheme, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCameraServerDigest(t *testing.T) {
+	server := NewServer(&testutil.MockLogger{})
+	server.SetAuth(Auth{Scheme: "digest", Username: "admin", Secret: "s3cret"})
+
+	get := func(creds *httpauth.Credentials) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/snap.jpg", nil)
+		req.Header.Set("X-Camera-ID", "camera_1")
+		if creds != nil {
+			req.Header.Set("Authorization", creds.String())
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(nil)
+	challenges := w.Header().Values("WWW-Authenticate")
+	if len(challenges) != 2 {
+		t.Fatalf("expected SHA-256 and MD5 challenges, got %q", challenges)
+	}
+	challenge, ok := httpauth.ParseChallenge(challenges)
+	if !ok || challenge.Algorithm != httpauth.SHA256 {
+		t.Fatalf("expected a SHA-256 challenge, got %+v", challenge)
+	}
+
+	// The nonce is reused with an increasing count
+	for nc := uint32(1); nc <= 2; nc++ {
+		creds := httpauth.Sign(challenge, "admin", "s3cret", http.MethodGet, "/snap.jpg", "cnonce", nc)
+		if w := get(&creds); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status 200, got %d", nc, w.Code)
+		}
+	}
+
+	replayed := httpauth.Sign(challenge, "admin", "s3cret", http.MethodGet, "/snap.jpg", "cnonce", 2)
+	if w := get(&replayed); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a replayed nonce count to be rejected, got %d", w.Code)
+	}
+
+	wrong := httpauth.Sign(challenge, "admin", "guess", http.MethodGet, "/snap.jpg", "cnonce", 3)
+	if w := get(&wrong); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a wrong password to be rejected, got %d", w.Code)
+	}
+
+	// Right credentials with an expired nonce are told to retry
+	server.auth.lifetime = 0
+	expired := httpauth.Sign(challenge, "admin", "s3cret", http.MethodGet, "/snap.jpg", "cnonce", 4)
+	w = get(&expired)
+	if next, _ := httpauth.ParseChallenge(w.Header().Values("WWW-Authenticate")); w.Code != http.StatusUnauthorized || !next.Stale {
+		t.Errorf("expected 401 with a stale challenge, got %d %+v", w.Code, next)
+	}
+}
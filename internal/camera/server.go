@@ -1,15 +1,27 @@
 package camera
 
 import (
+	"bytes"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/jpeg"
 	"net/http"
+	"time"
 
 	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
 )
 
-var mockImage = []byte{0xFF, 0xD8, 0xFF, 0xE0}
+// Size of the generated snapshots.
+const (
+	frameWidth  = 320
+	frameHeight = 240
+)
 
 type Server struct {
 	logger interfaces.Logger
+	auth   *authenticator
 }
 
 func NewServer(logger interfaces.Logger) *Server {
@@ -18,7 +30,19 @@ func NewServer(logger interfaces.Logger) *Server {
 	}
 }
 
+// SetAuth makes snapshot requests require credentials. It must be called
+// before the server is used.
+func (s *Server) SetAuth(a Auth) {
+	s.auth = newAuthenticator(a)
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.auth != nil && !s.auth.check(w, r) {
+		// Digest clients are expected to be challenged once
+		s.logger.Debug("challenged unauthenticated request", "scheme", s.auth.Scheme, "remote_addr", r.RemoteAddr)
+		return
+	}
+
 	cameraID := r.Header.Get("X-Camera-ID")
 
 	if cameraID == "" {
@@ -26,7 +50,40 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.logger.Printf("serving image request from camera %s", cameraID)
+	frame, err := snapshot(cameraID, time.Now())
+	if err != nil {
+		s.logger.Error("error encoding image", logging.KeyCameraID, cameraID, logging.KeyError, err)
+		http.Error(w, "Failed to encode image", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("serving image request", logging.KeyCameraID, cameraID, logging.KeyBytes, len(frame))
 	w.Header().Set("Content-Type", "image/jpeg")
-	w.Write(mockImage)
+	w.Write(frame)
+}
+
+// snapshot renders a JPEG of a grey apron with a bright vehicle crossing it,
+// so consecutive frames differ like those of a real stand. Each camera
+// starts the vehicle at a different point.
+func snapshot(cameraID string, at time.Time) ([]byte, error) {
+	h := fnv.New32a()
+	h.Write([]byte(cameraID))
+	x := (int(h.Sum32()) + int(at.UnixMilli()/100)) % frameWidth
+
+	img := image.NewGray(image.Rect(0, 0, frameWidth, frameHeight))
+	for py := 0; py < frameHeight; py++ {
+		for px := 0; px < frameWidth; px++ {
+			v := uint8(40 + py/4)
+			if px >= x && px < x+60 && py >= 120 && py < 170 {
+				v = 220
+			}
+			img.SetGray(px, py, color.Gray{Y: v})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
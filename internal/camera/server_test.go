@@ -1,6 +1,7 @@
 package camera
 
 import (
+	"image/jpeg"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -49,6 +50,12 @@ func TestCameraServer(t *testing.T) {
 			if tt.expectedType != "" && w.Header().Get("Content-Type") != tt.expectedType {
 				t.Errorf("expected content-type %s, got %s", tt.expectedType, w.Header().Get("Content-Type"))
 			}
+
+			if w.Code == http.StatusOK {
+				if _, err := jpeg.Decode(w.Body); err != nil {
+					t.Errorf("expected a decodable JPEG, got %v", err)
+				}
+			}
 		})
 	}
 }
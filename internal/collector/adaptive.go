@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"bytes"
+	"image/color"
+	"image/jpeg"
+	"math/bits"
+	"time"
+)
+
+// AdaptiveConfig makes pollers speed up while a camera's scene changes and
+// slow down while it is still, within MinInterval and MaxInterval. Frames
+// that look the same as the last one delivered are not sent.
+type AdaptiveConfig struct {
+	Enabled     bool
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// ChangeThreshold is the fraction of perceptual hash bits that must
+	// differ from the last delivered frame for a frame to count as changed.
+	ChangeThreshold float64
+}
+
+// next halves the interval after a scene change and doubles it otherwise,
+// keeping it within the configured bounds.
+func (a AdaptiveConfig) next(interval time.Duration, changed bool) time.Duration {
+	if changed {
+		interval /= 2
+	} else {
+		interval *= 2
+	}
+	return a.clamp(interval)
+}
+
+func (a AdaptiveConfig) clamp(interval time.Duration) time.Duration {
+	return min(max(interval, a.MinInterval), a.MaxInterval)
+}
+
+// sceneTracker remembers the last frame a poller delivered. It is owned by
+// a single poller goroutine.
+type sceneTracker struct {
+	threshold float64
+	last      uint64
+	seen      bool
+}
+
+// changed reports whether a frame with the given hash differs from the last
+// delivered one. Frames that could not be hashed always count as changed.
+func (s *sceneTracker) changed(hash uint64, ok bool) bool {
+	if !ok || !s.seen {
+		return true
+	}
+	return float64(bits.OnesCount64(hash^s.last))/64 > s.threshold
+}
+
+func (s *sceneTracker) delivered(hash uint64, ok bool) {
+	s.last, s.seen = hash, ok
+}
+
+// averageHash computes a 64-bit perceptual hash of a JPEG: the image is
+// reduced to an 8x8 grid of mean luminances and each bit records whether a
+// cell is brighter than the mean of the grid. Small changes in noise or
+// compression leave the hash mostly intact, while a moving object flips
+// the bits of the cells it crosses.
+func averageHash(data []byte) (uint64, bool) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, false
+	}
+
+	const grid, samples = 8, 8
+	b := img.Bounds()
+	if b.Dx() < grid || b.Dy() < grid {
+		return 0, false
+	}
+
+	var cells [grid * grid]float64
+	var total float64
+	for cy := 0; cy < grid; cy++ {
+		for cx := 0; cx < grid; cx++ {
+			// Sample a fixed number of points per cell so large frames cost
+			// no more than small ones
+			var sum float64
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					x := b.Min.X + (cx*samples+sx)*b.Dx()/(grid*samples)
+					y := b.Min.Y + (cy*samples+sy)*b.Dy()/(grid*samples)
+					sum += float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+				}
+			}
+			cells[cy*grid+cx] = sum / (samples * samples)
+			total += cells[cy*grid+cx]
+		}
+	}
+
+	mean := total / (grid * grid)
+	var hash uint64
+	for i, v := range cells {
+		if v > mean {
+			hash |= 1 << i
+		}
+	}
+	return hash, true
+}
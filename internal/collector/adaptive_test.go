@@ -0,0 +1,168 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	testutil "github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+// testJPEG encodes a grey 64x48 frame with a bright square at x and a
+// little per-frame noise.
+func testJPEG(t *testing.T, x int, noise uint8) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	for py := 0; py < 48; py++ {
+		for px := 0; px < 64; px++ {
+			v := 60 + uint8((px+py)%3)*noise
+			if px >= x && px < x+16 && py >= 16 && py < 32 {
+				v = 230
+			}
+			img.SetGray(px, py, color.Gray{Y: v})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSceneTracker(t *testing.T) {
+	still := testJPEG(t, 0, 0)
+
+	tests := []struct {
+		name    string
+		frame   []byte
+		changed bool
+	}{
+		{name: "identical frame", frame: still, changed: false},
+		{name: "sensor noise", frame: testJPEG(t, 0, 2), changed: false},
+		{name: "moved object", frame: testJPEG(t, 40, 0), changed: true},
+		{name: "undecodable frame", frame: []byte("not a jpeg"), changed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scene := &sceneTracker{threshold: 0.05}
+			scene.delivered(averageHash(still))
+			if got := scene.changed(averageHash(tt.frame)); got != tt.changed {
+				t.Errorf("expected changed=%v, got %v", tt.changed, got)
+			}
+		})
+	}
+}
+
+func TestAdaptiveConfigNext(t *testing.T) {
+	a := AdaptiveConfig{MinInterval: time.Second, MaxInterval: 8 * time.Second}
+
+	tests := []struct {
+		interval time.Duration
+		changed  bool
+		expected time.Duration
+	}{
+		{interval: 4 * time.Second, changed: true, expected: 2 * time.Second},
+		{interval: 4 * time.Second, changed: false, expected: 8 * time.Second},
+		{interval: 1500 * time.Millisecond, changed: true, expected: time.Second},
+		{interval: 6 * time.Second, changed: false, expected: 8 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := a.next(tt.interval, tt.changed); got != tt.expected {
+			t.Errorf("next(%s, %v): expected %s, got %s", tt.interval, tt.changed, tt.expected, got)
+		}
+	}
+}
+
+func TestCollectorAdaptivePolling(t *testing.T) {
+	frames := [][]byte{testJPEG(t, 0, 0), testJPEG(t, 40, 0)}
+	var moving atomic.Bool
+	var fetches atomic.Int64
+	fetcher := &mockFetcher{
+		fetchFunc: func(ctx context.Context, cameraID string) ([]byte, error) {
+			n := fetches.Add(1)
+			if moving.Load() {
+				return frames[n%2], nil
+			}
+			return frames[0], nil
+		},
+	}
+	var mu sync.Mutex
+	var sent []uint64
+	sender := &mockSender{
+		sendFunc: func(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, meta.Sequence)
+			return nil
+		},
+	}
+	countSent := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent)
+	}
+
+	c := NewCollector(Config{
+		CameraCount:  1,
+		PollInterval: 10 * time.Millisecond,
+		Adaptive: AdaptiveConfig{
+			Enabled:         true,
+			MinInterval:     5 * time.Millisecond,
+			MaxInterval:     40 * time.Millisecond,
+			ChangeThreshold: 0.05,
+		},
+	}, fetcher, sender, &testutil.MockLogger{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	interval := func() time.Duration {
+		return time.Duration(c.Cameras()[0].AdaptiveInterval)
+	}
+
+	waitFor("a still scene to slow polling down", func() bool { return interval() == 40*time.Millisecond })
+	if got := countSent(); got != 1 {
+		t.Errorf("expected only the first frame of a still scene to be sent, got %d", got)
+	}
+
+	moving.Store(true)
+	waitFor("a moving scene to speed polling up", func() bool { return interval() == 5*time.Millisecond })
+	if got := countSent(); got < 3 {
+		t.Errorf("expected changed frames to be sent, got %d", got)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, seq := range sent {
+		if seq != uint64(i+1) {
+			t.Errorf("expected skipped frames not to use sequence numbers, got %v", sent)
+			break
+		}
+	}
+}
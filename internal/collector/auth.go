@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/akhilesharora/turnaround-collector/internal/httpauth"
+)
+
+// AuthScheme is how the collector authenticates to a camera.
+type AuthScheme string
+
+const (
+	AuthBasic  AuthScheme = "basic"
+	AuthDigest AuthScheme = "digest"
+	AuthBearer AuthScheme = "bearer"
+)
+
+// CameraAuth holds the credentials a camera requires. The secret, the
+// password for basic and digest or the token for bearer, is kept out of the
+// config and read from SecretFile or the environment variable SecretEnv.
+type CameraAuth struct {
+	Scheme     AuthScheme `json:"scheme"`
+	Username   string     `json:"username,omitempty"`
+	SecretFile string     `json:"secret_file,omitempty"`
+	SecretEnv  string     `json:"secret_env,omitempty"`
+}
+
+func ParseAuthScheme(s string) (AuthScheme, error) {
+	switch p := AuthScheme(s); p {
+	case AuthBasic, AuthDigest, AuthBearer:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown auth scheme %q (want %s, %s or %s)", s, AuthBasic, AuthDigest, AuthBearer)
+}
+
+func (a CameraAuth) Validate() error {
+	if _, err := ParseAuthScheme(string(a.Scheme)); err != nil {
+		return err
+	}
+	if a.Scheme != AuthBearer && a.Username == "" {
+		return fmt.Errorf("%s auth requires a username", a.Scheme)
+	}
+	if (a.SecretFile == "") == (a.SecretEnv == "") {
+		return errors.New("auth requires exactly one of secret_file and secret_env")
+	}
+	_, err := a.secret()
+	return err
+}
+
+func (a CameraAuth) secret() (string, error) {
+	return ReadSecret(a.SecretFile, a.SecretEnv)
+}
+
+// ReadSecret returns the secret held by the environment variable env if
+// set, or else by file, without surrounding whitespace.
+func ReadSecret(file, env string) (string, error) {
+	if env != "" {
+		secret, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("secret_env %s is not set", env)
+		}
+		return secret, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("read secret_file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// cameraAuth authenticates the requests to one camera. For digest it keeps
+// the last challenge, so later requests reuse its nonce without another 401
+// round trip.
+type cameraAuth struct {
+	config CameraAuth
+	secret string
+
+	mu        sync.Mutex
+	challenge *httpauth.Challenge
+	nc        uint32
+}
+
+// authFor returns the authentication state for cam, or nil if the camera
+// needs none. The secret is read when the camera's auth settings change or
+// after the camera rejected it.
+func (c *Client) authFor(cam CameraConfig) (*cameraAuth, error) {
+	if cam.Auth == nil {
+		return nil, nil
+	}
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	if a, ok := c.auth[cam.ID]; ok && a.config == *cam.Auth {
+		return a, nil
+	}
+	secret, err := cam.Auth.secret()
+	if err != nil {
+		return nil, err
+	}
+	a := &cameraAuth{config: *cam.Auth, secret: secret}
+	if c.auth == nil {
+		c.auth = make(map[string]*cameraAuth)
+	}
+	c.auth[cam.ID] = a
+	return a, nil
+}
+
+// rejected forgets the state of a camera that refused its credentials.
+func (c *Client) rejected(cameraID string, a *cameraAuth) {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	if c.auth[cameraID] == a {
+		delete(c.auth, cameraID)
+	}
+}
+
+// authorize adds credentials to req. Digest requests only carry them once
+// a challenge was received.
+func (a *cameraAuth) authorize(req *http.Request) {
+	switch a.config.Scheme {
+	case AuthBasic:
+		req.SetBasicAuth(a.config.Username, a.secret)
+	case AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+a.secret)
+	case AuthDigest:
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.challenge == nil {
+			return
+		}
+		a.nc++
+		creds := httpauth.Sign(*a.challenge, a.config.Username, a.secret, req.Method, req.URL.RequestURI(), cnonce(), a.nc)
+		req.Header.Set("Authorization", creds.String())
+	}
+}
+
+// challenged takes the challenge of a 401 response and reports whether the
+// request is worth repeating with it: a digest camera that was not answered
+// yet, or that only found the nonce stale.
+func (a *cameraAuth) challenged(req *http.Request, resp *http.Response) bool {
+	if a.config.Scheme != AuthDigest {
+		return false
+	}
+	challenge, ok := httpauth.ParseChallenge(resp.Header.Values("WWW-Authenticate"))
+	if !ok {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.challenge, a.nc = &challenge, 0
+	return req.Header.Get("Authorization") == "" || challenge.Stale
+}
+
+func cnonce() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
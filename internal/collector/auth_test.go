@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/camera"
+	testutil "github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+func TestCameraAuthValidate(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(secretFile, []byte("s3cret\n"), 0o600)
+	t.Setenv("CAMERA_TOKEN", "token")
+
+	tests := []struct {
+		name      string
+		auth      CameraAuth
+		expectErr bool
+	}{
+		{name: "basic with secret file", auth: CameraAuth{Scheme: AuthBasic, Username: "admin", SecretFile: secretFile}},
+		{name: "bearer with secret env", auth: CameraAuth{Scheme: AuthBearer, SecretEnv: "CAMERA_TOKEN"}},
+		{name: "unknown scheme", auth: CameraAuth{Scheme: "ntlm", Username: "admin", SecretFile: secretFile}, expectErr: true},
+		{name: "digest without username", auth: CameraAuth{Scheme: AuthDigest, SecretFile: secretFile}, expectErr: true},
+		{name: "no secret", auth: CameraAuth{Scheme: AuthBearer}, expectErr: true},
+		{name: "two secrets", auth: CameraAuth{Scheme: AuthBearer, SecretFile: secretFile, SecretEnv: "CAMERA_TOKEN"}, expectErr: true},
+		{name: "missing secret file", auth: CameraAuth{Scheme: AuthBearer, SecretFile: secretFile + ".missing"}, expectErr: true},
+		{name: "unset secret env", auth: CameraAuth{Scheme: AuthBearer, SecretEnv: "CAMERA_TOKEN_UNSET"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.auth.Validate(); (err != nil) != tt.expectErr {
+				t.Errorf("expected error %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestClientCameraAuth(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(secretFile, []byte("s3cret\n"), 0o600)
+	t.Setenv("CAMERA_PASSWORD", "s3cret")
+
+	tests := []struct {
+		name string
+		// camera is what the camera demands, auth what the collector sends
+		camera camera.Auth
+		auth   *CameraAuth
+		// expectedRequests counts the requests of the first and second fetch
+		expectedRequests [2]int64
+		expectedStatus   int
+	}{
+		{
+			name:             "basic",
+			camera:           camera.Auth{Scheme: "basic", Username: "admin", Secret: "s3cret"},
+			auth:             &CameraAuth{Scheme: AuthBasic, Username: "admin", SecretFile: secretFile},
+			expectedRequests: [2]int64{1, 1},
+		},
+		{
+			name:             "bearer",
+			camera:           camera.Auth{Scheme: "bearer", Secret: "s3cret"},
+			auth:             &CameraAuth{Scheme: AuthBearer, SecretEnv: "CAMERA_PASSWORD"},
+			expectedRequests: [2]int64{1, 1},
+		},
+		{
+			name:   "digest reuses the nonce",
+			camera: camera.Auth{Scheme: "digest", Username: "admin", Secret: "s3cret"},
+			auth:   &CameraAuth{Scheme: AuthDigest, Username: "admin", SecretEnv: "CAMERA_PASSWORD"},
+			// The first fetch is challenged, the second answers up front
+			expectedRequests: [2]int64{2, 1},
+		},
+		{
+			name:   "digest with wrong username",
+			camera: camera.Auth{Scheme: "digest", Username: "admin", Secret: "s3cret"},
+			auth:   &CameraAuth{Scheme: AuthDigest, Username: "viewer", SecretFile: secretFile},
+			// A rejected camera starts over, reading the secret again
+			expectedRequests: [2]int64{2, 2},
+			expectedStatus:   http.StatusUnauthorized,
+		},
+		{
+			name:             "no credentials",
+			camera:           camera.Auth{Scheme: "basic", Username: "admin", Secret: "s3cret"},
+			expectedRequests: [2]int64{1, 1},
+			expectedStatus:   http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := camera.NewServer(&testutil.MockLogger{})
+			server.SetAuth(tt.camera)
+			var requests atomic.Int64
+			cam := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				server.ServeHTTP(w, r)
+			}))
+			defer cam.Close()
+
+			cameras, err := NewRegistry([]CameraConfig{{ID: "auth_cam", URL: cam.URL, SnapshotPath: "/snap.jpg", Enabled: true, Auth: tt.auth}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := NewClient(time.Second, cameras, "")
+
+			for i, expected := range tt.expectedRequests {
+				requests.Store(0)
+				data, err := client.FetchImage(context.Background(), "auth_cam")
+				if tt.expectedStatus != 0 {
+					var statusErr *StatusError
+					if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.expectedStatus {
+						t.Fatalf("fetch %d: expected status %d, got %v", i+1, tt.expectedStatus, err)
+					}
+				} else if err != nil || len(data) == 0 {
+					t.Fatalf("fetch %d: expected a frame, got %v", i+1, err)
+				}
+				if got := requests.Load(); got != expected {
+					t.Errorf("fetch %d: expected %d requests, got %d", i+1, expected, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the breaker.
+	FailureThreshold int
+	// Cooldown is how long the breaker stays open before letting a probe through.
+	Cooldown time.Duration
+}
+
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		FailureThreshold: 5,
+		Cooldown:         30 * time.Second,
+	}
+}
+
+type CircuitBreaker struct {
+	name   string
+	config BreakerConfig
+	logger interfaces.Logger
+	now    func() time.Time
+
+	// logArgs are extra key/value pairs added to transition logs
+	logArgs []any
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreaker(name string, config BreakerConfig, logger interfaces.Logger) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = DefaultBreakerConfig().FailureThreshold
+	}
+	breakerState.With(name).Set(float64(BreakerClosed))
+	return &CircuitBreaker{
+		name:   name,
+		config: config,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Allow returns ErrCircuitOpen while the breaker is open. Once the cooldown
+// has passed a single probe request is let through in the half-open state.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.config.Cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of a request let through by Allow. Requests
+// aborted by the caller's own context are not held against the remote side.
+func (b *CircuitBreaker) Record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	switch {
+	case err == nil:
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.setState(BreakerClosed)
+		}
+	case ctx.Err() != nil:
+		return
+	default:
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.config.FailureThreshold {
+			b.openedAt = b.now()
+			if b.state != BreakerOpen {
+				b.setState(BreakerOpen)
+			}
+		}
+	}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *CircuitBreaker) setState(state BreakerState) {
+	args := append([]any{
+		"breaker", b.name,
+		"from", b.state.String(),
+		"to", state.String(),
+		"consecutive_failures", b.failures,
+	}, b.logArgs...)
+	if state == BreakerOpen {
+		b.logger.Warn("Circuit breaker state changed", args...)
+	} else {
+		b.logger.Info("Circuit breaker state changed", args...)
+	}
+	b.state = state
+	breakerState.With(b.name).Set(float64(state))
+}
+
+// BreakerFetcher keeps an independent circuit breaker per camera ID.
+type BreakerFetcher struct {
+	fetcher interfaces.ImageFetcher
+	config  BreakerConfig
+	logger  interfaces.Logger
+
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+func NewBreakerFetcher(fetcher interfaces.ImageFetcher, config BreakerConfig, logger interfaces.Logger) *BreakerFetcher {
+	return &BreakerFetcher{
+		fetcher:  fetcher,
+		config:   config,
+		logger:   logger,
+		breakers: make(map[string]*CircuitBreaker),
+	}
+}
+
+func (f *BreakerFetcher) FetchImage(ctx context.Context, cameraID string) ([]byte, error) {
+	breaker := f.breaker(cameraID)
+	if err := breaker.Allow(); err != nil {
+		return nil, fmt.Errorf("camera %s: %w", cameraID, err)
+	}
+
+	imageData, err := f.fetcher.FetchImage(ctx, cameraID)
+	// A camera answering with invalid images is reachable; the validation
+	// metrics report those frames
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		breaker.Record(ctx, nil)
+	} else {
+		breaker.Record(ctx, err)
+	}
+	return imageData, err
+}
+
+// States returns the current breaker state of every camera seen so far.
+func (f *BreakerFetcher) States() map[string]BreakerState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	states := make(map[string]BreakerState, len(f.breakers))
+	for id, breaker := range f.breakers {
+		states[id] = breaker.State()
+	}
+	return states
+}
+
+func (f *BreakerFetcher) breaker(cameraID string) *CircuitBreaker {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	breaker, ok := f.breakers[cameraID]
+	if !ok {
+		breaker = NewCircuitBreaker("camera "+cameraID, f.config, f.logger)
+		breaker.logArgs = []any{logging.KeyCameraID, cameraID}
+		f.breakers[cameraID] = breaker
+	}
+	return breaker
+}
+
+type BreakerSender struct {
+	sender  interfaces.ImageSender
+	breaker *CircuitBreaker
+}
+
+func NewBreakerSender(sender interfaces.ImageSender, name string, config BreakerConfig, logger interfaces.Logger) *BreakerSender {
+	return &BreakerSender{
+		sender:  sender,
+		breaker: NewCircuitBreaker(name, config, logger),
+	}
+}
+
+func (s *BreakerSender) SendImage(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+	if err := s.breaker.Allow(); err != nil {
+		return fmt.Errorf("%s: %w", s.breaker.name, err)
+	}
+
+	err := s.sender.SendImage(ctx, meta, imageData)
+	s.breaker.Record(ctx, err)
+	return err
+}
+
+func (s *BreakerSender) State() BreakerState {
+	return s.breaker.State()
+}
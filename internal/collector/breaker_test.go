@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	testutil "github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	logger := &testutil.MockLogger{}
+	breaker := NewCircuitBreaker("camera_1", BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute}, logger)
+
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	failure := errors.New("connection refused")
+
+	steps := []struct {
+		name          string
+		advance       time.Duration
+		result        error
+		expectAllowed bool
+		expectedState BreakerState
+	}{
+		{name: "first failure stays closed", result: failure, expectAllowed: true, expectedState: BreakerClosed},
+		{name: "threshold opens", result: failure, expectAllowed: true, expectedState: BreakerOpen},
+		{name: "open rejects", expectAllowed: false, expectedState: BreakerOpen},
+		{name: "failed probe reopens", advance: time.Minute, result: failure, expectAllowed: true, expectedState: BreakerOpen},
+		{name: "still cooling down", advance: 30 * time.Second, expectAllowed: false, expectedState: BreakerOpen},
+		{name: "successful probe closes", advance: 30 * time.Second, result: nil, expectAllowed: true, expectedState: BreakerClosed},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+
+		err := breaker.Allow()
+		if allowed := err == nil; allowed != step.expectAllowed {
+			t.Fatalf("%s: expected allowed=%v, got err=%v", step.name, step.expectAllowed, err)
+		}
+		if err == nil {
+			breaker.Record(ctx, step.result)
+		}
+		if state := breaker.State(); state != step.expectedState {
+			t.Fatalf("%s: expected state %s, got %s", step.name, step.expectedState, state)
+		}
+	}
+
+	found := false
+	for _, log := range logger.Logs {
+		if strings.Contains(log, "from=half-open to=closed") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected transition log, got:\n%s", strings.Join(logger.Logs, "\n"))
+	}
+}
+
+func TestCircuitBreakerHalfOpenSingleProbe(t *testing.T) {
+	breaker := NewCircuitBreaker("target", BreakerConfig{FailureThreshold: 1, Cooldown: 0}, &testutil.MockLogger{})
+	breaker.Record(context.Background(), errors.New("boom"))
+
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected probe to be allowed, got %v", err)
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected concurrent probe to be rejected, got %v", err)
+	}
+
+	// A probe abandoned by the caller does not count against the target
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	breaker.Record(ctx, context.Canceled)
+	if state := breaker.State(); state != BreakerHalfOpen {
+		t.Fatalf("expected half-open after canceled probe, got %s", state)
+	}
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected a new probe to be allowed, got %v", err)
+	}
+}
+
+func TestBreakerFetcherPerCamera(t *testing.T) {
+	calls := map[string]int{}
+	fetcher := &mockFetcher{
+		fetchFunc: func(ctx context.Context, cameraID string) ([]byte, error) {
+			calls[cameraID]++
+			switch cameraID {
+			case "camera_down":
+				return nil, errors.New("no route to host")
+			case "camera_invalid":
+				return []byte("<html>busy</html>"), invalid(InvalidMarkers, "missing JPEG start-of-image marker")
+			}
+			return []byte("test image"), nil
+		},
+	}
+
+	bf := NewBreakerFetcher(fetcher, BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute}, &testutil.MockLogger{})
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		bf.FetchImage(ctx, "camera_down")
+		bf.FetchImage(ctx, "camera_invalid")
+		if _, err := bf.FetchImage(ctx, "camera_up"); err != nil {
+			t.Fatalf("healthy camera failed: %v", err)
+		}
+	}
+
+	if calls["camera_down"] != 2 {
+		t.Errorf("expected broken camera to be called 2 times, got %d", calls["camera_down"])
+	}
+	if calls["camera_invalid"] != 5 {
+		t.Errorf("expected a camera sending invalid images to stay reachable, got %d calls", calls["camera_invalid"])
+	}
+	if calls["camera_up"] != 5 {
+		t.Errorf("expected healthy camera to be called 5 times, got %d", calls["camera_up"])
+	}
+
+	states := bf.States()
+	if states["camera_down"] != BreakerOpen || states["camera_up"] != BreakerClosed || states["camera_invalid"] != BreakerClosed {
+		t.Errorf("unexpected breaker states %v", states)
+	}
+}
@@ -3,67 +3,283 @@ package collector
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
-	"strings"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/bufpool"
+	"github.com/akhilesharora/turnaround-collector/internal/signing"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
 )
 
 type Client struct {
-	client    *http.Client
-	baseURL   string
+	client *http.Client
+	// insecure serves cameras that skip certificate verification
+	insecure *http.Client
+	cameras  *Registry
+	timeout  time.Duration
+	// limits, when set, makes FetchImage reject payloads that are not
+	// acceptable JPEGs
+	limits *ImageLimits
+	// maxBytes bounds the camera responses read; 0 means unlimited
+	maxBytes int64
+	// signer, when set, signs every request to a target
+	signer *signing.Key
+
+	mu        sync.RWMutex
 	targetURL string
+
+	authMu sync.Mutex
+	auth   map[string]*cameraAuth
+
+	targetReached atomic.Bool
 }
 
-func NewClient(timeout time.Duration, baseURL, targetURL string) *Client {
+func NewClient(timeout time.Duration, cameras *Registry, targetURL string) *Client {
 	return &Client{
-		client: &http.Client{
-			Timeout: timeout,
-		},
-		baseURL:   baseURL,
+		client:    &http.Client{},
+		insecure:  &http.Client{Transport: newTransport(&tls.Config{InsecureSkipVerify: true})},
+		cameras:   cameras,
+		timeout:   timeout,
 		targetURL: targetURL,
 	}
 }
 
-func (c *Client) FetchImage(ctx context.Context, cameraID int) ([]byte, error) {
-	baseURL := strings.TrimRight(c.baseURL, "/")
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/snap.jpg", nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+// SetTargetURL changes where subsequent images are sent.
+func (c *Client) SetTargetURL(targetURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targetURL = targetURL
+}
+
+// SetTLSConfig configures TLS for camera and target connections. Cameras
+// with InsecureSkipVerify use the same settings without verification. It
+// must be called before the client is used.
+func (c *Client) SetTLSConfig(cfg *tls.Config) {
+	c.client.Transport = newTransport(cfg)
+	insecure := cfg.Clone()
+	insecure.InsecureSkipVerify = true
+	c.insecure.Transport = newTransport(insecure)
+}
+
+func newTransport(cfg *tls.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	return transport
+}
+
+// SetImageValidation makes FetchImage check every payload with
+// ValidateImage. It must be called before the client is used.
+func (c *Client) SetImageValidation(limits ImageLimits) {
+	c.limits = &limits
+}
+
+// SetMaxResponseBytes bounds the size of camera responses. Larger ones are
+// rejected with a ValidationError once the limit is reached, without being
+// read any further. It must be called before the client is used.
+func (c *Client) SetMaxResponseBytes(n int64) {
+	c.maxBytes = n
+}
+
+// SetSigningKey makes the client sign every image it sends with key. It
+// must be called before the client is used.
+func (c *Client) SetSigningKey(key signing.Key) {
+	c.signer = &key
+}
+
+// FetchImage returns the snapshot in a pooled buffer, which the caller may
+// hand back with bufpool.Put once done with it.
+func (c *Client) FetchImage(ctx context.Context, cameraID string) ([]byte, error) {
+	start := time.Now()
+	requestsInFlight.With(opFetch).Inc()
+	defer requestsInFlight.With(opFetch).Dec()
+
+	imageData, err := c.fetchImage(ctx, cameraID)
+
+	// The camera answered, so a bad payload is not a request error
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		invalidImagesTotal.With(cameraID, invalid.Reason).Inc()
+		observeRequest(opFetch, cameraID, start, len(imageData), nil)
+		bufpool.Put(imageData)
+		return nil, err
 	}
+	observeRequest(opFetch, cameraID, start, len(imageData), err)
+	return imageData, err
+}
 
-	// Set camera ID in a custom header
-	req.Header.Set("X-Camera-ID", fmt.Sprintf("camera_%d", cameraID))
+func (c *Client) fetchImage(ctx context.Context, cameraID string) ([]byte, error) {
+	cam, ok := c.cameras.Get(cameraID)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCamera, cameraID)
+	}
 
-	resp, err := c.client.Do(req)
+	// Per-camera timeout overrides the client default
+	timeout := c.timeout
+	if cam.Timeout > 0 {
+		timeout = time.Duration(cam.Timeout)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	resp, err := c.openSnapshot(ctx, cam)
 	if err != nil {
-		return nil, fmt.Errorf("fetch failed: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	imageData, err := bufpool.ReadAll(c.limitBody(resp), resp.ContentLength)
+	if err != nil {
+		return nil, err
+	}
+	if c.limits != nil {
+		if err := ValidateImage(resp.Header.Get("Content-Type"), imageData, *c.limits); err != nil {
+			return imageData, err
+		}
+	}
+	return imageData, nil
+}
+
+// openSnapshot requests a snapshot from cam, answering a digest challenge
+// if needed. On success the caller closes the response body.
+func (c *Client) openSnapshot(ctx context.Context, cam CameraConfig) (*http.Response, error) {
+	auth, err := c.authFor(cam)
+	if err != nil {
+		return nil, fmt.Errorf("camera auth: %w", err)
+	}
+
+	resp, err := c.getSnapshot(ctx, cam, auth)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && auth != nil {
+		if auth.challenged(resp.Request, resp) {
+			resp.Body.Close()
+			if resp, err = c.getSnapshot(ctx, cam, auth); err != nil {
+				return nil, err
+			}
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			// Read the secret again next time, in case it was rotated
+			c.rejected(cam.ID, auth)
+		}
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+		resp.Body.Close()
+		return nil, newStatusError(resp)
 	}
+	return resp, nil
+}
 
-	return io.ReadAll(resp.Body)
+func (c *Client) getSnapshot(ctx context.Context, cam CameraConfig, auth *cameraAuth) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cam.SnapshotURL(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	// Set camera ID in a custom header
+	req.Header.Set("X-Camera-ID", cam.ID)
+	if auth != nil {
+		auth.authorize(req)
+	}
+
+	client := c.client
+	if cam.InsecureSkipVerify {
+		client = c.insecure
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch failed: %w", err)
+	}
+	return resp, nil
 }
 
-func (c *Client) SendImage(ctx context.Context, imageData []byte) error {
+func (c *Client) SendImage(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+	c.mu.RLock()
 	targetURL := c.targetURL
+	c.mu.RUnlock()
+
+	return c.send(ctx, targetURL, meta, imageData)
+}
+
+// Target returns a sender that posts to targetURL instead of the client's
+// own target, sharing its connections and TLS settings.
+func (c *Client) Target(targetURL string) interfaces.ImageSender {
+	return &targetSender{client: c, targetURL: targetURL}
+}
+
+type targetSender struct {
+	client    *Client
+	targetURL string
+}
 
+func (s *targetSender) SendImage(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+	return s.client.send(ctx, s.targetURL, meta, imageData)
+}
+
+func (c *Client) send(ctx context.Context, targetURL string, meta interfaces.ImageMetadata, imageData []byte) error {
+	start := time.Now()
+	requestsInFlight.With(opSend).Inc()
+	defer requestsInFlight.With(opSend).Dec()
+
+	err := c.sendImage(ctx, targetURL, meta, imageData)
+	observeRequest(opSend, meta.CameraID, start, len(imageData), err)
+	if err == nil {
+		c.targetReached.Store(true)
+	}
+	return err
+}
+
+// TargetReached reports whether at least one image was accepted by the target.
+func (c *Client) TargetReached() bool {
+	return c.targetReached.Load()
+}
+
+func (c *Client) sendImage(ctx context.Context, targetURL string, meta interfaces.ImageMetadata, imageData []byte) error {
 	parsedURL, err := url.Parse(targetURL)
 	if err != nil {
 		return fmt.Errorf("invalid target URL: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, parsedURL.String(),
-		bytes.NewReader(imageData))
+	// The transport may still be writing the body after Do returned; the
+	// deferred wait runs after cancel, which makes it let go of the body
+	body := newRequestBody(imageData)
+	defer body.wait()
+	var cancel context.CancelFunc
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, parsedURL.String(), body)
 	if err != nil {
+		body.Close()
 		return fmt.Errorf("create request: %w", err)
 	}
+	req.ContentLength = int64(len(imageData))
 	req.Header.Set("Content-Type", "image/jpeg")
+	meta.SetHeaders(req.Header)
+	if c.signer != nil {
+		bodyHash := meta.ContentHash
+		if bodyHash == "" {
+			sum := sha256.Sum256(imageData)
+			bodyHash = hex.EncodeToString(sum[:])
+		}
+		c.signer.Sign(req.Header, req.Method, req.URL.EscapedPath(), bodyHash, time.Now())
+	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -71,9 +287,66 @@ func (c *Client) SendImage(ctx context.Context, imageData []byte) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	// A target with a work queue accepts frames before processing them
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return newStatusError(resp)
 	}
 
 	return nil
 }
+
+// requestBody reads an image into a request and reports when the transport
+// closed it, after which the image buffer may be reused.
+type requestBody struct {
+	bytes.Reader
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newRequestBody(data []byte) *requestBody {
+	b := &requestBody{closed: make(chan struct{})}
+	b.Reset(data)
+	return b
+}
+
+func (b *requestBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
+
+func (b *requestBody) wait() {
+	<-b.closed
+}
+
+// StatusError is returned when a camera or target answers with a non-200 status.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status: %d", e.StatusCode)
+}
+
+// parseRetryAfter accepts both delay-seconds and HTTP-date forms.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,359 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/bufpool"
+	"github.com/akhilesharora/turnaround-collector/internal/signing"
+	"github.com/akhilesharora/turnaround-collector/internal/target"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+func TestClientFetchImage(t *testing.T) {
+	camera := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow.jpg" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		// Echo what the camera saw so the test can assert on it
+		w.Write([]byte(r.Header.Get("X-Camera-ID") + " " + r.URL.Path))
+	}))
+	defer camera.Close()
+
+	cameras, err := NewRegistry([]CameraConfig{
+		{ID: "gate_a", URL: camera.URL, SnapshotPath: "/cgi-bin/snap.jpg", Enabled: true},
+		{ID: "gate_b", URL: camera.URL, SnapshotPath: "/slow.jpg", Timeout: Duration(10 * time.Millisecond), Enabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(time.Second, cameras, "")
+
+	tests := []struct {
+		name         string
+		cameraID     string
+		expectErr    bool
+		expectedBody string
+	}{
+		{
+			name:         "camera specific snapshot path",
+			cameraID:     "gate_a",
+			expectedBody: "gate_a /cgi-bin/snap.jpg",
+		},
+		{
+			name:      "per-camera timeout",
+			cameraID:  "gate_b",
+			expectErr: true,
+		},
+		{
+			name:      "unknown camera",
+			cameraID:  "gate_c",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := client.FetchImage(context.Background(), tt.cameraID)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(data) != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, data)
+			}
+		})
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+	camera := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("12345"))
+	}))
+	defer camera.Close()
+
+	cameras, _ := NewRegistry([]CameraConfig{{ID: "metrics_cam", URL: camera.URL, Enabled: true}})
+	client := NewClient(time.Second, cameras, "")
+
+	bytesBefore := requestBytesTotal.With(opFetch, "metrics_cam").Value()
+	latencyBefore := requestDurationSeconds.With(opFetch, "metrics_cam").Count()
+
+	if _, err := client.FetchImage(context.Background(), "metrics_cam"); err != nil {
+		t.Fatal(err)
+	}
+	client.FetchImage(context.Background(), "missing_cam")
+
+	if got := requestBytesTotal.With(opFetch, "metrics_cam").Value() - bytesBefore; got != 5 {
+		t.Errorf("expected 5 fetched bytes recorded, got %v", got)
+	}
+	if got := requestDurationSeconds.With(opFetch, "metrics_cam").Count() - latencyBefore; got != 1 {
+		t.Errorf("expected 1 latency observation, got %d", got)
+	}
+	if got := requestErrorsTotal.With(opFetch, "missing_cam").Value(); got < 1 {
+		t.Errorf("expected fetch error to be counted, got %v", got)
+	}
+}
+
+func TestClientSendImageMetadata(t *testing.T) {
+	received := make(chan interfaces.ImageMetadata, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		meta, err := interfaces.MetadataFromHeaders(r.Header)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received <- meta
+	}))
+	defer target.Close()
+
+	client := NewClient(time.Second, DefaultRegistry(0, ""), target.URL+"/image")
+	sent := interfaces.ImageMetadata{
+		CameraID:       "camera_7",
+		CapturedAt:     time.Date(2024, 11, 2, 10, 15, 30, 123456789, time.UTC),
+		FetchLatency:   42 * time.Millisecond,
+		Sequence:       9,
+		ContentHash:    "abc123",
+		RequestedAt:    time.Date(2024, 11, 2, 10, 15, 30, 0, time.UTC),
+		FrameSetID:     "stand_12@20241102T101530.000Z",
+		DuplicateOf:    8,
+		IdempotencyKey: "camera_7-1730542530123456789-9",
+	}
+
+	if err := client.SendImage(context.Background(), sent, []byte("image")); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != sent {
+		t.Errorf("expected metadata %+v, got %+v", sent, got)
+	}
+	if !client.TargetReached() {
+		t.Error("expected target to be marked as reached")
+	}
+}
+
+func TestClientSendImageStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		expectErr bool
+	}{
+		{name: "processed", status: http.StatusOK},
+		{name: "queued", status: http.StatusAccepted},
+		{name: "queue full", status: http.StatusTooManyRequests, expectErr: true},
+		{name: "no content", status: http.StatusNoContent, expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer target.Close()
+
+			client := NewClient(time.Second, DefaultRegistry(0, ""), target.URL+"/image")
+			err := client.SendImage(context.Background(), interfaces.ImageMetadata{CameraID: "camera_1"}, []byte("image"))
+			if (err != nil) != tt.expectErr {
+				t.Errorf("expected error=%v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestClientSendImageEarlyResponse(t *testing.T) {
+	// The target answers without reading the body; SendImage must still
+	// return once the transport let go of the image
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Image too large", http.StatusRequestEntityTooLarge)
+	}))
+	defer target.Close()
+
+	client := NewClient(time.Second, nil, target.URL+"/image")
+	err := client.SendImage(context.Background(), interfaces.ImageMetadata{CameraID: "camera_1"}, make([]byte, 8<<20))
+	if err == nil {
+		t.Fatal("expected the send to fail")
+	}
+}
+
+// BenchmarkClientFrame fetches a frame and sends it on, as every tick does.
+// "unpooled" makes the same requests reading into a fresh buffer and
+// sending from a fresh reader per frame, for comparison.
+func BenchmarkClientFrame(b *testing.B) {
+	frame := bytes.Repeat([]byte{0xAB}, 200<<10)
+	camera := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(frame)
+	}))
+	defer camera.Close()
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer target.Close()
+
+	cameras, _ := NewRegistry([]CameraConfig{{ID: "bench_cam", URL: camera.URL, Enabled: true}})
+	client := NewClient(time.Second, cameras, target.URL+"/image")
+	meta := interfaces.ImageMetadata{CameraID: "bench_cam", Sequence: 1}
+	ctx := context.Background()
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, err := client.FetchImage(ctx, "bench_cam")
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := client.SendImage(ctx, meta, data); err != nil {
+				b.Fatal(err)
+			}
+			bufpool.Put(data)
+		}
+	})
+
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		cam, _ := cameras.Get("bench_cam")
+		for i := 0; i < b.N; i++ {
+			fetchCtx, cancel := context.WithTimeout(ctx, time.Second)
+			resp, err := client.openSnapshot(fetchCtx, cam)
+			if err != nil {
+				b.Fatal(err)
+			}
+			data, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			cancel()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			sendCtx, cancel := context.WithTimeout(ctx, time.Second)
+			req, _ := http.NewRequestWithContext(sendCtx, http.MethodPost, target.URL+"/image", bytes.NewReader(data))
+			req.Header.Set("Content-Type", "image/jpeg")
+			meta.SetHeaders(req.Header)
+			resp, err = client.client.Do(req)
+			if err != nil {
+				b.Fatal(err)
+			}
+			resp.Body.Close()
+			cancel()
+		}
+	})
+}
+
+type processorFunc func(interfaces.ImageMetadata, []byte) error
+
+func (f processorFunc) Process(meta interfaces.ImageMetadata, imageData []byte) error {
+	return f(meta, imageData)
+}
+
+func TestClientSigning(t *testing.T) {
+	key := signing.Key{ID: "collector-1", Client: "collector", Secret: "shared secret"}
+	frame := testJPEG(t, 0, 0)
+	camera := testCamera(t, "image/jpeg", frame, true)
+
+	tests := []struct {
+		name      string
+		signWith  *signing.Key
+		stream    bool
+		expectErr bool
+	}{
+		{name: "signed send", signWith: &key},
+		{name: "signed stream", signWith: &key, stream: true},
+		{name: "wrong secret", signWith: &signing.Key{ID: key.ID, Secret: "guess"}, expectErr: true},
+		{name: "unsigned", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processed := 0
+			server := target.NewServer(&testutils.MockLogger{}, processorFunc(func(interfaces.ImageMetadata, []byte) error {
+				processed++
+				return nil
+			}))
+			server.SetKeys([]signing.Key{key})
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			cameras, _ := NewRegistry([]CameraConfig{{ID: "camera_1", URL: camera.URL, Enabled: true}})
+			client := NewClient(time.Second, cameras, ts.URL+"/image")
+			if tt.signWith != nil {
+				client.SetSigningKey(*tt.signWith)
+			}
+
+			var err error
+			if tt.stream {
+				_, err = client.StreamImage(context.Background(), interfaces.ImageMetadata{CameraID: "camera_1"})
+			} else {
+				err = client.SendImage(context.Background(), interfaces.ImageMetadata{CameraID: "camera_1"}, frame)
+			}
+			if tt.expectErr {
+				if err == nil || processed != 0 {
+					t.Errorf("expected the target to refuse the delivery, got %v with %d processed", err, processed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if processed != 1 {
+				t.Errorf("expected 1 processed delivery, got %d", processed)
+			}
+		})
+	}
+}
+
+func TestClientCameraTLS(t *testing.T) {
+	camera := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("frame"))
+	}))
+	camera.Config.ErrorLog = log.New(io.Discard, "", 0)
+	camera.StartTLS()
+	defer camera.Close()
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(camera.Certificate())
+
+	tests := []struct {
+		name      string
+		tlsConfig *tls.Config
+		insecure  bool
+		expectErr bool
+	}{
+		{name: "unknown certificate", expectErr: true},
+		{name: "legacy camera skipping verification", insecure: true},
+		{name: "trusted CA", tlsConfig: &tls.Config{RootCAs: trusted}},
+		{name: "skipping verification with a custom CA", tlsConfig: &tls.Config{RootCAs: x509.NewCertPool()}, insecure: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cameras, _ := NewRegistry([]CameraConfig{
+				{ID: "tls_cam", URL: camera.URL, Enabled: true, InsecureSkipVerify: tt.insecure},
+			})
+			client := NewClient(time.Second, cameras, "")
+			if tt.tlsConfig != nil {
+				client.SetTLSConfig(tt.tlsConfig)
+			}
+
+			data, err := client.FetchImage(context.Background(), "tls_cam")
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected the certificate to be rejected")
+				}
+				return
+			}
+			if err != nil || string(data) != "frame" {
+				t.Fatalf("expected the frame, got %q and %v", data, err)
+			}
+		})
+	}
+}
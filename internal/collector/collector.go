@@ -2,12 +2,19 @@ package collector
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/akhilesharora/turnaround-collector/internal/bufpool"
+	"github.com/akhilesharora/turnaround-collector/internal/health"
 	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
 )
 
 type Config struct {
@@ -16,108 +23,531 @@ type Config struct {
 	MaxConcurrent int
 	CameraBaseURL string
 	TargetURL     string
+	// AlignPolls fires cameras on wall-clock multiples of their poll interval,
+	// so cameras sharing an interval capture at the same instants and frames
+	// of a camera group carry a shared FrameSetID.
+	AlignPolls bool
+	// Duplicates decides what happens to frames identical to the last one
+	// delivered for their camera. Defaults to DuplicatesSend.
+	Duplicates DuplicatePolicy
+	// FrozenAfter is the number of consecutive identical frames after which a
+	// camera is reported frozen; 0 disables the check.
+	FrozenAfter int
+	// Adaptive varies each camera's poll interval with how much its scene
+	// changes, starting from the camera's regular interval.
+	Adaptive AdaptiveConfig
+
+	// Cameras to poll. When nil, CameraCount cameras behind CameraBaseURL are used.
+	Cameras *Registry
 }
 
 type Collector struct {
+	cameras  *Registry
+	fetcher  interfaces.ImageFetcher
+	sender   interfaces.ImageSender
+	streamer interfaces.ImageStreamer
+	logger   interfaces.Logger
+	sem      *semaphore
+	outcomes *health.SuccessRate
+
+	// mu guards config and the running pollers, which Reload changes live
+	mu      sync.Mutex
 	config  Config
-	fetcher interfaces.ImageFetcher
-	sender  interfaces.ImageSender
-	logger  interfaces.Logger
-	sem     chan struct{}
+	runCtx  context.Context
+	pollers map[string]*poller
+	paused  map[string]bool
+	wg      sync.WaitGroup
+
+	statusMu sync.Mutex
+	statuses map[string]*cameraHealth
+
+	seqMu     sync.Mutex
+	sequences map[string]uint64
+}
+
+// poller is the goroutine polling a single camera. Its ctx is canceled when
+// the camera is removed, which stops polling but lets a frame in flight finish.
+type poller struct {
+	ctx      context.Context
+	stop     context.CancelFunc
+	schedule chan schedule
+	// interval is the current adaptive poll interval in nanoseconds.
+	interval atomic.Int64
+}
+
+// setSchedule hands a new schedule to the poller. Callers hold mu.
+func (p *poller) setSchedule(sched schedule) {
+	select {
+	case <-p.schedule: // Drop a schedule not yet picked up
+	default:
+	}
+	p.schedule <- sched
+}
+
+// schedule says when a poller fires.
+type schedule struct {
+	interval time.Duration
+	aligned  bool
+	adaptive AdaptiveConfig
+}
+
+// next returns the first firing time after t.
+func (s schedule) next(t time.Time) time.Time {
+	if s.aligned {
+		n := s.interval.Nanoseconds()
+		return time.Unix(0, (t.UnixNano()/n+1)*n)
+	}
+	return t.Add(s.interval)
+}
+
+// every returns the schedule with its interval replaced.
+func (s schedule) every(interval time.Duration) schedule {
+	s.interval = interval
+	return s
 }
 
+// successRateWindow is the number of recent frames readiness is judged on.
+const successRateWindow = 50
+
 func NewCollector(config Config, fetcher interfaces.ImageFetcher, sender interfaces.ImageSender, logger interfaces.Logger) *Collector {
+	config = withDefaults(config)
+
+	return &Collector{
+		cameras:   config.Cameras,
+		config:    config,
+		fetcher:   fetcher,
+		sender:    sender,
+		logger:    logger,
+		sem:       newSemaphore(config.MaxConcurrent),
+		outcomes:  health.NewSuccessRate(successRateWindow),
+		pollers:   make(map[string]*poller),
+		paused:    make(map[string]bool),
+		statuses:  make(map[string]*cameraHealth),
+		sequences: make(map[string]uint64),
+	}
+}
+
+func withDefaults(config Config) Config {
+	if config.Cameras == nil {
+		config.Cameras = DefaultRegistry(config.CameraCount, config.CameraBaseURL)
+	}
 	if config.MaxConcurrent <= 0 {
-		config.MaxConcurrent = config.CameraCount
+		config.MaxConcurrent = len(config.Cameras.Enabled())
+	}
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = 1
 	}
 	if config.PollInterval == 0 {
 		config.PollInterval = 5 * time.Second
 	}
+	if config.Duplicates == "" {
+		config.Duplicates = DuplicatesSend
+	}
+	if config.Adaptive.Enabled {
+		if config.Adaptive.MinInterval <= 0 {
+			config.Adaptive.MinInterval = config.PollInterval
+		}
+		if config.Adaptive.MaxInterval < config.Adaptive.MinInterval {
+			config.Adaptive.MaxInterval = config.Adaptive.MinInterval
+		}
+	}
+	return config
+}
+
+// intervalFor returns the poll interval of cam, honoring its override.
+func (config Config) intervalFor(cam CameraConfig) time.Duration {
+	if cam.PollInterval > 0 {
+		return time.Duration(cam.PollInterval)
+	}
+	return config.PollInterval
+}
 
-	return &Collector{
-		config:  config,
-		fetcher: fetcher,
-		sender:  sender,
-		logger:  logger,
-		sem:     make(chan struct{}, config.MaxConcurrent),
+func (config Config) scheduleFor(cam CameraConfig) schedule {
+	sched := schedule{interval: config.intervalFor(cam), aligned: config.AlignPolls}
+	if config.Adaptive.Enabled {
+		sched.adaptive = config.Adaptive
 	}
+	return sched
+}
+
+// SetStreamer makes the collector stream frames from cameras to the target
+// instead of fetching and sending them, which bypasses the fetcher and
+// sender and, as frames are never held in memory, duplicate detection and
+// adaptive polling. It must be called before Start.
+func (c *Collector) SetStreamer(streamer interfaces.ImageStreamer) {
+	c.streamer = streamer
+}
+
+// SuccessRate tracks the outcome of recently processed frames.
+func (c *Collector) SuccessRate() *health.SuccessRate {
+	return c.outcomes
 }
 
 func (c *Collector) Start(ctx context.Context) error {
-	var wg sync.WaitGroup
-	errCh := make(chan error, c.config.CameraCount)
-
-	// Start a goroutine for each camera
-	for i := 0; i < c.config.CameraCount; i++ {
-		wg.Add(1)
-		go func(cameraID int) {
-			defer wg.Done()
-			// pollCamera runs indefinitely until ctx is canceled
-			// or it gets to a fatal situation
-			err := c.pollCamera(ctx, cameraID)
-			if err != nil && !errors.Is(err, context.Canceled) {
-				select {
-				case errCh <- fmt.Errorf("camera %d error: %w", cameraID, err):
-				case <-ctx.Done():
-				}
-			}
-		}(i + 1)
+	c.mu.Lock()
+	c.runCtx = ctx
+	// Start a goroutine for each enabled camera
+	for _, cam := range c.config.Cameras.Enabled() {
+		if !c.paused[cam.ID] {
+			c.startPoller(cam)
+		}
 	}
+	c.mu.Unlock()
 
-	go func() {
-		wg.Wait()
-		close(errCh)
-	}()
+	<-ctx.Done()
+	c.logger.Info("Collector context canceled; shutting down")
+	c.wg.Wait()
+
+	return nil
+}
 
-	// Handle errors of camera polling
+// startPoller runs pollCamera for cam until the collector stops or the
+// camera is removed or paused. Callers hold mu.
+func (c *Collector) startPoller(cam CameraConfig) {
+	cameraID := cam.ID
+	ctx, stop := context.WithCancel(c.runCtx)
+	p := &poller{ctx: ctx, stop: stop, schedule: make(chan schedule, 1)}
+	c.pollers[cameraID] = p
+
+	runCtx, sched := c.runCtx, c.config.scheduleFor(cam)
+	c.wg.Add(1)
 	go func() {
-		for err := range errCh {
-			c.logger.Printf("Collector caught error: %v", err)
+		defer c.wg.Done()
+		// pollCamera runs indefinitely until ctx is canceled
+		// or it gets to a fatal situation
+		err := c.pollCamera(runCtx, cameraID, p, sched)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			c.logger.Error("Collector caught error", logging.KeyError, fmt.Errorf("camera %s error: %w", cameraID, err))
 		}
 	}()
+}
 
-	<-ctx.Done()
-	c.logger.Printf("Collector context canceled; shutting down.")
+// Reload applies a new configuration to the running collector. Pollers are
+// started and stopped for added and removed cameras, while the poll interval
+// and concurrency limit change without interrupting frames in flight.
+// The camera registry is updated in place so fetchers sharing it see the
+// new camera URLs.
+func (c *Collector) Reload(config Config) {
+	config = withDefaults(config)
 
-	return nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.config
+
+	oldCameras := make(map[string]CameraConfig)
+	for _, cam := range old.Cameras.Cameras() {
+		oldCameras[cam.ID] = cam
+	}
+	newCameras := make(map[string]CameraConfig)
+	for _, cam := range config.Cameras.Cameras() {
+		newCameras[cam.ID] = cam
+	}
+
+	if config.Cameras != old.Cameras {
+		old.Cameras.Replace(config.Cameras)
+		config.Cameras = old.Cameras
+	}
+	c.config = config
+
+	for id, cam := range oldCameras {
+		if _, ok := newCameras[id]; !ok {
+			c.logger.Info("Camera removed", logging.KeyCameraID, id)
+		} else if !reflect.DeepEqual(newCameras[id], cam) {
+			c.logger.Info("Camera updated", logging.KeyCameraID, id)
+		}
+	}
+	for id := range newCameras {
+		if _, ok := oldCameras[id]; !ok {
+			c.logger.Info("Camera added", logging.KeyCameraID, id)
+		}
+	}
+
+	if config.PollInterval != old.PollInterval {
+		c.logger.Info("Poll interval changed", "from", old.PollInterval, "to", config.PollInterval)
+	}
+	if config.AlignPolls != old.AlignPolls {
+		c.logger.Info("Poll alignment changed", "aligned", config.AlignPolls)
+	}
+	if config.Duplicates != old.Duplicates || config.FrozenAfter != old.FrozenAfter {
+		c.logger.Info("Duplicate handling changed", "duplicates", config.Duplicates, "frozen_after", config.FrozenAfter)
+	}
+	if config.Adaptive != old.Adaptive {
+		c.logger.Info("Adaptive polling changed",
+			"enabled", config.Adaptive.Enabled,
+			"min_interval", config.Adaptive.MinInterval,
+			"max_interval", config.Adaptive.MaxInterval,
+			"change_threshold", config.Adaptive.ChangeThreshold,
+		)
+	}
+	for id, p := range c.pollers {
+		if to := config.scheduleFor(newCameras[id]); to != old.scheduleFor(oldCameras[id]) {
+			p.setSchedule(to)
+		}
+	}
+	if config.MaxConcurrent != old.MaxConcurrent {
+		c.logger.Info("Concurrency limit changed", "from", old.MaxConcurrent, "to", config.MaxConcurrent)
+		c.sem.SetLimit(config.MaxConcurrent)
+	}
+	if config.TargetURL != old.TargetURL {
+		c.logger.Info("Target URL changed", "from", old.TargetURL, "to", config.TargetURL)
+	}
+
+	for id := range c.paused {
+		if _, ok := newCameras[id]; !ok {
+			delete(c.paused, id)
+		}
+	}
+	c.syncPollers()
+}
+
+// syncPollers starts pollers for enabled, unpaused cameras and stops the
+// rest. Callers hold mu.
+func (c *Collector) syncPollers() {
+	if c.runCtx == nil {
+		return
+	}
+	active := make(map[string]bool)
+	for _, cam := range c.config.Cameras.Enabled() {
+		if c.paused[cam.ID] {
+			continue
+		}
+		active[cam.ID] = true
+		if _, running := c.pollers[cam.ID]; !running {
+			c.startPoller(cam)
+		}
+	}
+	for id, p := range c.pollers {
+		if !active[id] {
+			p.stop()
+			delete(c.pollers, id)
+		}
+	}
 }
 
-func (c *Collector) pollCamera(ctx context.Context, cameraID int) error {
-	ticker := time.NewTicker(c.config.PollInterval)
-	defer ticker.Stop()
+func (c *Collector) pollCamera(ctx context.Context, cameraID string, p *poller, sched schedule) error {
+	// With adaptive polling the poller steps by its current interval and
+	// keeps track of the last scene it delivered
+	var scene *sceneTracker
+	current := sched
+	reset := func() {
+		scene, current = nil, sched
+		if sched.adaptive.Enabled {
+			scene = &sceneTracker{threshold: sched.adaptive.ChangeThreshold}
+			current = sched.every(sched.adaptive.clamp(sched.interval))
+		}
+		p.interval.Store(int64(current.interval))
+	}
+	reset()
+
+	due := current.next(time.Now())
+	timer := time.NewTimer(time.Until(due))
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-ctx.Done():
+		case <-p.ctx.Done():
 			return ctx.Err()
-		case <-ticker.C:
-			select {
-			case c.sem <- struct{}{}: // Acquire semaphore
-				err := c.processCameraImage(ctx, cameraID)
-				<-c.sem // Release semaphore
-				if err != nil {
-					c.logger.Printf("Camera %d error: %v", cameraID, err)
-					continue
-				}
-			case <-ctx.Done():
+		case sched = <-p.schedule:
+			reset()
+			due = current.next(time.Now())
+			timer.Reset(time.Until(due))
+		case <-timer.C:
+			var frameSetID string
+			if sched.aligned {
+				frameSetID = c.frameSetID(cameraID, due)
+			}
+
+			waitStart := time.Now()
+			if err := c.sem.Acquire(p.ctx); err != nil {
 				return ctx.Err()
 			}
+			semaphoreWaitSeconds.With().Observe(time.Since(waitStart).Seconds())
+			framesInFlight.With().Inc()
+			changed, err := c.processCameraImage(ctx, frameRequest{
+				cameraID:    cameraID,
+				requestedAt: due,
+				frameSetID:  frameSetID,
+				scene:       scene,
+			})
+			framesInFlight.With().Dec()
+			c.sem.Release()
+			if ctx.Err() == nil {
+				c.outcomes.Record(err == nil)
+				c.recordStatus(cameraID, err)
+			}
+			if err != nil {
+				// Breaker transitions are logged on their own; don't repeat them every tick
+				if !errors.Is(err, ErrCircuitOpen) {
+					c.logger.Warn("Camera error", logging.KeyCameraID, cameraID, logging.KeyError, err)
+				}
+			} else if sched.adaptive.Enabled {
+				if interval := sched.adaptive.next(current.interval, changed); interval != current.interval {
+					c.logger.Debug("Adaptive poll interval changed",
+						logging.KeyCameraID, cameraID,
+						"from", current.interval,
+						"to", interval,
+						"scene_changed", changed,
+					)
+					current = current.every(interval)
+					p.interval.Store(int64(interval))
+				}
+			}
+
+			// Like a ticker, skip instants missed while the frame was in flight
+			due = current.next(due)
+			if now := time.Now(); due.Before(now) {
+				due = current.next(now)
+			}
+			timer.Reset(time.Until(due))
 		}
 	}
 }
 
-func (c *Collector) processCameraImage(ctx context.Context, cameraID int) error {
+// frameSetID names the frames a camera group captures for one aligned
+// instant. Cameras without a group share the "default" group.
+func (c *Collector) frameSetID(cameraID string, at time.Time) string {
+	group := "default"
+	if cam, ok := c.cameras.Get(cameraID); ok && cam.Group != "" {
+		group = cam.Group
+	}
+	return group + "@" + at.UTC().Format("20060102T150405.000Z")
+}
+
+// frameRequest describes one capture of a camera.
+type frameRequest struct {
+	cameraID    string
+	requestedAt time.Time
+	frameSetID  string
+	// scene, when set, skips frames that look like the last one delivered
+	scene *sceneTracker
+	// manual captures are requested through the API and always sent
+	manual bool
+}
+
+// processCameraImage fetches a frame and sends it on. The result reports
+// whether the frame was new, as opposed to skipped as unchanged or as a
+// duplicate of the last frame delivered.
+func (c *Collector) processCameraImage(ctx context.Context, req frameRequest) (bool, error) {
+	cameraID := req.cameraID
+	if c.streamer != nil {
+		return true, c.streamCameraImage(ctx, req)
+	}
+	c.mu.Lock()
+	duplicates, frozenAfter := c.config.Duplicates, c.config.FrozenAfter
+	c.mu.Unlock()
+
 	// Fetch image
+	start := time.Now()
 	imageData, err := c.fetcher.FetchImage(ctx, cameraID)
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		framesTotal.With(cameraID, "invalid_image").Inc()
+		return false, err
+	}
 	if err != nil {
-		return fmt.Errorf("fetch failed: %w", err)
+		framesTotal.With(cameraID, "fetch_error").Inc()
+		return false, fmt.Errorf("fetch failed: %w", err)
+	}
+	defer bufpool.Put(imageData)
+
+	hash := sha256.Sum256(imageData)
+	contentHash := hex.EncodeToString(hash[:])
+	var duplicateOf uint64
+	if original := c.observeContent(cameraID, contentHash, frozenAfter); original != 0 {
+		switch {
+		case duplicates == DuplicatesSkip && !req.manual:
+			framesTotal.With(cameraID, "duplicate").Inc()
+			c.logger.Debug("Skipped duplicate frame", logging.KeyCameraID, cameraID, "duplicate_of", original)
+			return false, nil
+		case duplicates != DuplicatesSend:
+			duplicateOf = original
+		}
+	}
+
+	var sceneHash uint64
+	var hashed bool
+	if req.scene != nil {
+		sceneHash, hashed = averageHash(imageData)
+		if !req.scene.changed(sceneHash, hashed) {
+			framesTotal.With(cameraID, "unchanged").Inc()
+			c.logger.Debug("Skipped unchanged frame", logging.KeyCameraID, cameraID)
+			return false, nil
+		}
+	}
+
+	sequence := c.nextSequence(cameraID)
+	meta := interfaces.ImageMetadata{
+		CameraID:     cameraID,
+		CapturedAt:   start,
+		FetchLatency: time.Since(start),
+		Sequence:     sequence,
+		ContentHash:  contentHash,
+		RequestedAt:  req.requestedAt,
+		FrameSetID:   req.frameSetID,
+		DuplicateOf:  duplicateOf,
+		// Sequences restart with the collector; the capture time keeps keys unique
+		IdempotencyKey: fmt.Sprintf("%s-%d-%d", cameraID, start.UnixNano(), sequence),
 	}
 
 	// Send image
-	if err := c.sender.SendImage(ctx, imageData); err != nil {
-		return fmt.Errorf("send failed: %w", err)
+	if err := c.sender.SendImage(ctx, meta, imageData); err != nil {
+		framesTotal.With(cameraID, "send_error").Inc()
+		return true, fmt.Errorf("send failed: %w", err)
+	}
+	if req.scene != nil {
+		req.scene.delivered(sceneHash, hashed)
+	}
+	if duplicateOf == 0 {
+		c.recordDelivery(cameraID, contentHash, sequence)
+	}
+
+	framesTotal.With(cameraID, "success").Inc()
+	c.logger.Info("Successfully processed image",
+		logging.KeyCameraID, cameraID,
+		"sequence", meta.Sequence,
+		logging.KeyBytes, len(imageData),
+		logging.KeyDurationMS, time.Since(start).Milliseconds(),
+	)
+	return duplicateOf == 0, nil
+}
+
+func (c *Collector) streamCameraImage(ctx context.Context, req frameRequest) error {
+	cameraID := req.cameraID
+	start := time.Now()
+	sequence := c.nextSequence(cameraID)
+	meta := interfaces.ImageMetadata{
+		CameraID:       cameraID,
+		CapturedAt:     start,
+		Sequence:       sequence,
+		RequestedAt:    req.requestedAt,
+		FrameSetID:     req.frameSetID,
+		IdempotencyKey: fmt.Sprintf("%s-%d-%d", cameraID, start.UnixNano(), sequence),
 	}
 
-	c.logger.Printf("Successfully processed image from camera %d", cameraID)
+	n, err := c.streamer.StreamImage(ctx, meta)
+	var invalid *ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		framesTotal.With(cameraID, "invalid_image").Inc()
+		return err
+	case err != nil:
+		framesTotal.With(cameraID, "stream_error").Inc()
+		return fmt.Errorf("stream failed: %w", err)
+	}
+
+	framesTotal.With(cameraID, "success").Inc()
+	c.logger.Info("Successfully streamed image",
+		logging.KeyCameraID, cameraID,
+		"sequence", sequence,
+		logging.KeyBytes, n,
+		logging.KeyDurationMS, time.Since(start).Milliseconds(),
+	)
 	return nil
 }
+
+func (c *Collector) nextSequence(cameraID string) uint64 {
+	c.seqMu.Lock()
+	defer c.seqMu.Unlock()
+	c.sequences[cameraID]++
+	return c.sequences[cameraID]
+}
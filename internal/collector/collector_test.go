@@ -4,28 +4,30 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
 	testutil "github.com/akhilesharora/turnaround-collector/pkg/testutils"
 )
 
 // Mock fetcher
 type mockFetcher struct {
-	fetchFunc func(ctx context.Context, cameraID int) ([]byte, error)
+	fetchFunc func(ctx context.Context, cameraID string) ([]byte, error)
 }
 
-func (m *mockFetcher) FetchImage(ctx context.Context, cameraID int) ([]byte, error) {
+func (m *mockFetcher) FetchImage(ctx context.Context, cameraID string) ([]byte, error) {
 	return m.fetchFunc(ctx, cameraID)
 }
 
 // Mock sender
 type mockSender struct {
-	sendFunc func(ctx context.Context, imageData []byte) error
+	sendFunc func(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error
 }
 
-func (m *mockSender) SendImage(ctx context.Context, imageData []byte) error {
-	return m.sendFunc(ctx, imageData)
+func (m *mockSender) SendImage(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+	return m.sendFunc(ctx, meta, imageData)
 }
 
 func TestCollector(t *testing.T) {
@@ -80,7 +82,7 @@ func TestCollector(t *testing.T) {
 
 			// Set up fetcher
 			fetcher := &mockFetcher{
-				fetchFunc: func(ctx context.Context, cameraID int) ([]byte, error) {
+				fetchFunc: func(ctx context.Context, cameraID string) ([]byte, error) {
 					if tt.fetchError != nil {
 						return nil, tt.fetchError
 					}
@@ -90,7 +92,7 @@ func TestCollector(t *testing.T) {
 
 			// Set up sender
 			sender := &mockSender{
-				sendFunc: func(ctx context.Context, imageData []byte) error {
+				sendFunc: func(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
 					if tt.sendError != nil {
 						return tt.sendError
 					}
@@ -149,3 +151,139 @@ func TestCollector(t *testing.T) {
 		})
 	}
 }
+
+func TestCollectorReload(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	fetcher := &mockFetcher{
+		fetchFunc: func(ctx context.Context, cameraID string) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[cameraID]++
+			return []byte("test image"), nil
+		},
+	}
+	sender := &mockSender{
+		sendFunc: func(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+			return nil
+		},
+	}
+	countCalls := func(cameraID string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[cameraID]
+	}
+
+	registry := DefaultRegistry(2, "http://camera")
+	logger := &testutil.MockLogger{}
+	c := NewCollector(Config{PollInterval: time.Hour, Cameras: registry}, fetcher, sender, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	next, err := NewRegistry([]CameraConfig{
+		{ID: "camera_2", URL: "http://camera-2", Enabled: true},
+		{ID: "camera_3", URL: "http://camera", Enabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	c.Reload(Config{PollInterval: 10 * time.Millisecond, MaxConcurrent: 1, Cameras: next})
+
+	time.Sleep(100 * time.Millisecond)
+	if countCalls("camera_1") != 0 {
+		t.Errorf("expected removed camera not to be polled, got %d calls", countCalls("camera_1"))
+	}
+	if countCalls("camera_2") == 0 || countCalls("camera_3") == 0 {
+		t.Errorf("expected remaining and added cameras to be polled at the new interval, got %d and %d calls",
+			countCalls("camera_2"), countCalls("camera_3"))
+	}
+
+	// The registry is updated in place for fetchers sharing it
+	if cam, _ := registry.Get("camera_2"); cam.URL != "http://camera-2" {
+		t.Errorf("expected shared registry to be updated, got %+v", cam)
+	}
+
+	logs := strings.Join(logger.Snapshot(), "\n")
+	for _, expected := range []string{
+		"Camera removed camera_id=camera_1",
+		"Camera updated camera_id=camera_2",
+		"Camera added camera_id=camera_3",
+		"Poll interval changed from=1h0m0s to=10ms",
+		"Concurrency limit changed from=2 to=1",
+	} {
+		if !strings.Contains(logs, expected) {
+			t.Errorf("expected log %q, got:\n%s", expected, logs)
+		}
+	}
+}
+
+func TestCollectorAlignedPolls(t *testing.T) {
+	registry, err := NewRegistry([]CameraConfig{
+		{ID: "nose", URL: "http://nose", Enabled: true, Group: "stand_12"},
+		{ID: "tail", URL: "http://tail", Enabled: true, Group: "stand_12"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	frameSets := map[string][]interfaces.ImageMetadata{}
+	fetcher := &mockFetcher{
+		fetchFunc: func(ctx context.Context, cameraID string) ([]byte, error) {
+			return []byte("test image"), nil
+		},
+	}
+	sender := &mockSender{
+		sendFunc: func(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			frameSets[meta.FrameSetID] = append(frameSets[meta.FrameSetID], meta)
+			return nil
+		},
+	}
+
+	interval := 20 * time.Millisecond
+	c := NewCollector(Config{PollInterval: interval, AlignPolls: true, Cameras: registry}, fetcher, sender, &testutil.MockLogger{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 110*time.Millisecond)
+	defer cancel()
+	c.Start(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(frameSets) < 2 {
+		t.Fatalf("expected several frame sets, got %d", len(frameSets))
+	}
+	complete := 0
+	for id, metas := range frameSets {
+		if !strings.HasPrefix(id, "stand_12@") {
+			t.Errorf("unexpected frame set id %q", id)
+		}
+		for _, meta := range metas {
+			if meta.RequestedAt.UnixNano()%interval.Nanoseconds() != 0 {
+				t.Errorf("requested time %v not aligned to %v", meta.RequestedAt, interval)
+			}
+			if !meta.RequestedAt.Equal(metas[0].RequestedAt) {
+				t.Errorf("frame set %s mixes instants %v and %v", id, metas[0].RequestedAt, meta.RequestedAt)
+			}
+			if meta.CapturedAt.Before(meta.RequestedAt) {
+				t.Errorf("captured at %v before requested %v", meta.CapturedAt, meta.RequestedAt)
+			}
+		}
+		if len(metas) == 2 {
+			complete++
+		}
+	}
+	if complete == 0 {
+		t.Errorf("expected both cameras in at least one frame set, got %v", frameSets)
+	}
+}
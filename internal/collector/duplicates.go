@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+// DuplicatePolicy decides what happens to a frame whose content is
+// identical to the last frame delivered for its camera.
+type DuplicatePolicy string
+
+const (
+	// DuplicatesSend delivers duplicates like any other frame.
+	DuplicatesSend DuplicatePolicy = "send"
+	// DuplicatesMark delivers duplicates with DuplicateOf set.
+	DuplicatesMark DuplicatePolicy = "mark"
+	// DuplicatesSkip drops duplicates without delivering them.
+	DuplicatesSkip DuplicatePolicy = "skip"
+)
+
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	switch p := DuplicatePolicy(s); p {
+	case DuplicatesSend, DuplicatesMark, DuplicatesSkip:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown duplicate policy %q (want %s, %s or %s)", s, DuplicatesSend, DuplicatesMark, DuplicatesSkip)
+}
+
+// observeContent records the content hash of a fetched frame and returns the
+// sequence of the last delivered frame with the same content, or 0. After
+// frozenAfter consecutive identical frames the camera is reported frozen.
+func (c *Collector) observeContent(cameraID, hash string, frozenAfter int) uint64 {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	h := c.health(cameraID)
+
+	if hash != h.lastHash {
+		if h.frozen {
+			c.logger.Info("Camera unfrozen", logging.KeyCameraID, cameraID, "duplicates", h.duplicates)
+			cameraFrozen.With(cameraID).Set(0)
+		}
+		h.lastHash, h.duplicates, h.frozen = hash, 0, false
+	} else {
+		h.duplicates++
+		if frozenAfter > 0 && h.duplicates >= frozenAfter && !h.frozen {
+			h.frozen = true
+			c.logger.Warn("Camera frozen; it keeps returning the same frame",
+				logging.KeyCameraID, cameraID,
+				"duplicates", h.duplicates,
+			)
+			cameraFrozen.With(cameraID).Set(1)
+		}
+	}
+
+	if hash == h.deliveredHash {
+		return h.deliveredSequence
+	}
+	return 0
+}
+
+// recordDelivery remembers the content of the last frame sent for a camera.
+func (c *Collector) recordDelivery(cameraID, hash string, sequence uint64) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	h := c.health(cameraID)
+	h.deliveredHash, h.deliveredSequence = hash, sequence
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	testutil "github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+func TestCollectorDuplicateFrames(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      DuplicatePolicy
+		expectSent  func(fetched, sent int) bool
+		expectFirst uint64 // DuplicateOf of the second frame sent
+	}{
+		{
+			name:       "send",
+			policy:     DuplicatesSend,
+			expectSent: func(fetched, sent int) bool { return sent == fetched },
+		},
+		{
+			name:        "mark",
+			policy:      DuplicatesMark,
+			expectSent:  func(fetched, sent int) bool { return sent == fetched },
+			expectFirst: 1,
+		},
+		{
+			name:       "skip",
+			policy:     DuplicatesSkip,
+			expectSent: func(fetched, sent int) bool { return sent == 1 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetched atomic.Int64
+			fetcher := &mockFetcher{
+				fetchFunc: func(ctx context.Context, cameraID string) ([]byte, error) {
+					fetched.Add(1)
+					return []byte("frozen frame"), nil
+				},
+			}
+			var mu sync.Mutex
+			var sent []interfaces.ImageMetadata
+			sender := &mockSender{
+				sendFunc: func(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+					mu.Lock()
+					defer mu.Unlock()
+					sent = append(sent, meta)
+					return nil
+				},
+			}
+
+			logger := &testutil.MockLogger{}
+			c := NewCollector(Config{
+				CameraCount:  1,
+				PollInterval: 5 * time.Millisecond,
+				Duplicates:   tt.policy,
+				FrozenAfter:  3,
+			}, fetcher, sender, logger)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- c.Start(ctx)
+			}()
+			for fetched.Load() < 5 {
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+			<-done
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !tt.expectSent(int(fetched.Load()), len(sent)) {
+				t.Errorf("unexpected number of frames sent: fetched %d, sent %d", fetched.Load(), len(sent))
+			}
+			if len(sent) > 1 && sent[1].DuplicateOf != tt.expectFirst {
+				t.Errorf("expected second frame to be a duplicate of %d, got %d", tt.expectFirst, sent[1].DuplicateOf)
+			}
+			keys := make(map[string]bool)
+			for _, meta := range sent {
+				if meta.IdempotencyKey == "" || keys[meta.IdempotencyKey] {
+					t.Errorf("expected a unique idempotency key, got %q", meta.IdempotencyKey)
+				}
+				keys[meta.IdempotencyKey] = true
+			}
+
+			status, err := c.Camera("camera_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !status.Frozen {
+				t.Errorf("expected camera to be reported frozen, got %+v", status)
+			}
+			if !strings.Contains(strings.Join(logger.Logs, "\n"), "Camera frozen") {
+				t.Errorf("expected a frozen camera warning, got:\n%s", strings.Join(logger.Logs, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/metrics"
+)
+
+var (
+	framesTotal = metrics.Default.NewCounterVec("collector_frames_total",
+		"Frames processed per camera by result (success, unchanged, duplicate, fetch_error, invalid_image, send_error, stream_error).", "camera", "result")
+	semaphoreWaitSeconds = metrics.Default.NewHistogramVec("collector_semaphore_wait_seconds",
+		"Time pollers waited for a concurrency slot.", metrics.DefBuckets)
+	framesInFlight = metrics.Default.NewGaugeVec("collector_frames_in_flight",
+		"Frames currently being fetched or sent.")
+
+	requestDurationSeconds = metrics.Default.NewHistogramVec("collector_http_request_duration_seconds",
+		"Duration of camera fetches and target sends.", metrics.DefBuckets, "op", "camera")
+	requestBytesTotal = metrics.Default.NewCounterVec("collector_http_bytes_total",
+		"Image bytes fetched from cameras and sent to the target.", "op", "camera")
+	requestErrorsTotal = metrics.Default.NewCounterVec("collector_http_errors_total",
+		"Failed camera fetches and target sends.", "op", "camera")
+	requestsInFlight = metrics.Default.NewGaugeVec("collector_http_requests_in_flight",
+		"HTTP requests currently in flight.", "op")
+
+	invalidImagesTotal = metrics.Default.NewCounterVec("collector_invalid_images_total",
+		"Camera responses rejected by image validation, by reason.", "camera", "reason")
+
+	targetFramesTotal = metrics.Default.NewCounterVec("collector_target_frames_total",
+		"Frames handed to each fan-out target by result (success, failure, dropped).", "target", "result")
+
+	cameraFrozen = metrics.Default.NewGaugeVec("collector_camera_frozen",
+		"Whether a camera keeps returning the same frame: 1 frozen, 0 not.", "camera")
+
+	breakerState = metrics.Default.NewGaugeVec("collector_circuit_breaker_state",
+		"Circuit breaker state: 0 closed, 1 open, 2 half-open.", "breaker")
+)
+
+const (
+	opFetch = "fetch"
+	opSend  = "send"
+)
+
+func observeRequest(op, cameraID string, start time.Time, bytes int, err error) {
+	requestDurationSeconds.With(op, cameraID).Observe(time.Since(start).Seconds())
+	if err != nil {
+		requestErrorsTotal.With(op, cameraID).Inc()
+		return
+	}
+	requestBytesTotal.With(op, cameraID).Add(float64(bytes))
+}
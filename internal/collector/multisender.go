@@ -0,0 +1,195 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/bufpool"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+// DeliveryPolicy decides whether a target's failures fail the frame.
+type DeliveryPolicy string
+
+const (
+	// DeliveryRequired targets must accept a frame for it to count as sent.
+	DeliveryRequired DeliveryPolicy = "required"
+	// DeliveryBestEffort targets are sent to in the background; failures are
+	// only counted and logged.
+	DeliveryBestEffort DeliveryPolicy = "best-effort"
+)
+
+func ParseDeliveryPolicy(s string) (DeliveryPolicy, error) {
+	switch p := DeliveryPolicy(s); p {
+	case DeliveryRequired, DeliveryBestEffort:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown delivery policy %q (want %s or %s)", s, DeliveryRequired, DeliveryBestEffort)
+}
+
+// Route selects the cameras a target receives frames from. An empty route
+// matches every camera.
+type Route struct {
+	Cameras []string
+	Tags    []string
+}
+
+func (r Route) Matches(cam CameraConfig) bool {
+	if len(r.Cameras) == 0 && len(r.Tags) == 0 {
+		return true
+	}
+	return slices.Contains(r.Cameras, cam.ID) || cam.HasTag(r.Tags...)
+}
+
+type Target struct {
+	Name     string
+	Sender   interfaces.ImageSender
+	Delivery DeliveryPolicy
+	Route    Route
+	// MaxInFlight bounds background sends to a best-effort target; frames
+	// beyond it are dropped for that target. Defaults to 4.
+	MaxInFlight int
+}
+
+// TargetStats counts the frames handed to a single target.
+type TargetStats struct {
+	Name        string         `json:"name"`
+	Delivery    DeliveryPolicy `json:"delivery"`
+	Sent        uint64         `json:"sent"`
+	Failed      uint64         `json:"failed"`
+	Dropped     uint64         `json:"dropped"`
+	LastError   string         `json:"last_error,omitempty"`
+	LastErrorAt *time.Time     `json:"last_error_at,omitempty"`
+}
+
+type fanoutTarget struct {
+	Target
+	inFlight chan struct{}
+
+	mu    sync.Mutex
+	stats TargetStats
+}
+
+// MultiSender delivers each frame to every target whose route matches its
+// camera. Targets are sent to concurrently, and SendImage only waits for
+// the required ones, so a slow best-effort target never holds up a frame.
+type MultiSender struct {
+	targets []*fanoutTarget
+	cameras *Registry
+	logger  interfaces.Logger
+}
+
+func NewMultiSender(targets []Target, cameras *Registry, logger interfaces.Logger) *MultiSender {
+	s := &MultiSender{cameras: cameras, logger: logger}
+	for _, t := range targets {
+		if t.Delivery == "" {
+			t.Delivery = DeliveryRequired
+		}
+		if t.MaxInFlight <= 0 {
+			t.MaxInFlight = 4
+		}
+		s.targets = append(s.targets, &fanoutTarget{
+			Target:   t,
+			inFlight: make(chan struct{}, t.MaxInFlight),
+			stats:    TargetStats{Name: t.Name, Delivery: t.Delivery},
+		})
+	}
+	return s
+}
+
+func (s *MultiSender) SendImage(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+	cam, ok := s.cameras.Get(meta.CameraID)
+	if !ok {
+		cam = CameraConfig{ID: meta.CameraID}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(s.targets))
+	for i, t := range s.targets {
+		if !t.Route.Matches(cam) {
+			continue
+		}
+
+		if t.Delivery == DeliveryBestEffort {
+			select {
+			case t.inFlight <- struct{}{}:
+			default:
+				t.record(meta, errDropped, s.logger)
+				continue
+			}
+			// Best-effort sends outlive the frame, but not their own timeouts.
+			// The frame's buffer is reused once SendImage returns, so they get
+			// a copy
+			data := append(bufpool.Get(len(imageData)), imageData...)
+			go func() {
+				defer func() { <-t.inFlight }()
+				defer bufpool.Put(data)
+				t.record(meta, t.Sender.SendImage(context.WithoutCancel(ctx), meta, data), s.logger)
+			}()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := t.Sender.SendImage(ctx, meta, imageData)
+			t.record(meta, err, s.logger)
+			if err != nil {
+				errs[i] = fmt.Errorf("target %s: %w", t.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// errDropped marks a frame skipped because a best-effort target is saturated.
+var errDropped = errors.New("too many sends in flight; frame dropped")
+
+func (t *fanoutTarget) record(meta interfaces.ImageMetadata, err error, logger interfaces.Logger) {
+	result := "success"
+	t.mu.Lock()
+	switch {
+	case err == nil:
+		t.stats.Sent++
+	case errors.Is(err, errDropped):
+		t.stats.Dropped++
+		result = "dropped"
+	default:
+		t.stats.Failed++
+		result = "failure"
+	}
+	if err != nil {
+		now := time.Now()
+		t.stats.LastError = err.Error()
+		t.stats.LastErrorAt = &now
+	}
+	t.mu.Unlock()
+
+	targetFramesTotal.With(t.Name, result).Inc()
+	if err != nil && t.Delivery == DeliveryBestEffort && !errors.Is(err, ErrCircuitOpen) {
+		logger.Warn("Best-effort delivery failed",
+			"target", t.Name,
+			logging.KeyCameraID, meta.CameraID,
+			"sequence", meta.Sequence,
+			logging.KeyError, err,
+		)
+	}
+}
+
+// Stats returns the per-target counters in target order.
+func (s *MultiSender) Stats() []TargetStats {
+	stats := make([]TargetStats, 0, len(s.targets))
+	for _, t := range s.targets {
+		t.mu.Lock()
+		stats = append(stats, t.stats)
+		t.mu.Unlock()
+	}
+	return stats
+}
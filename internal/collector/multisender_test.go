@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	testutil "github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+// recordingSender remembers which cameras it received frames from.
+type recordingSender struct {
+	mu      sync.Mutex
+	cameras []string
+	err     error
+}
+
+func (s *recordingSender) SendImage(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cameras = append(s.cameras, meta.CameraID)
+	return s.err
+}
+
+func (s *recordingSender) received() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.cameras, ",")
+}
+
+func TestMultiSenderRouting(t *testing.T) {
+	registry, err := NewRegistry([]CameraConfig{
+		{ID: "nose", URL: "http://nose", Enabled: true, Tags: []string{"stand_12"}},
+		{ID: "tail", URL: "http://tail", Enabled: true, Tags: []string{"stand_12", "apron"}},
+		{ID: "gate", URL: "http://gate", Enabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	analytics := &recordingSender{}
+	apron := &recordingSender{}
+	gate := &recordingSender{}
+	s := NewMultiSender([]Target{
+		{Name: "analytics", Sender: analytics},
+		{Name: "apron", Sender: apron, Route: Route{Tags: []string{"apron"}}},
+		{Name: "gate", Sender: gate, Route: Route{Cameras: []string{"gate"}}},
+	}, registry, &testutil.MockLogger{})
+
+	for _, id := range []string{"nose", "tail", "gate"} {
+		if err := s.SendImage(context.Background(), interfaces.ImageMetadata{CameraID: id}, []byte("test image")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	for name, tt := range map[string]struct {
+		sender   *recordingSender
+		expected string
+	}{
+		"analytics": {analytics, "nose,tail,gate"},
+		"apron":     {apron, "tail"},
+		"gate":      {gate, "gate"},
+	} {
+		if got := tt.sender.received(); got != tt.expected {
+			t.Errorf("%s: expected frames from %q, got %q", name, tt.expected, got)
+		}
+	}
+}
+
+func TestMultiSenderDeliveryPolicy(t *testing.T) {
+	registry := DefaultRegistry(1, "http://camera")
+	meta := interfaces.ImageMetadata{CameraID: "camera_1"}
+
+	tests := []struct {
+		name      string
+		required  error
+		archive   error
+		expectErr string
+	}{
+		{name: "all succeed"},
+		{name: "best-effort failure is not fatal", archive: errors.New("disk full")},
+		{name: "required failure fails the frame", required: errors.New("unexpected status: 503"), expectErr: "target analytics: unexpected status: 503"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := &recordingSender{err: tt.archive}
+			s := NewMultiSender([]Target{
+				{Name: "analytics", Sender: &recordingSender{err: tt.required}, Delivery: DeliveryRequired},
+				{Name: "archive", Sender: archive, Delivery: DeliveryBestEffort},
+			}, registry, &testutil.MockLogger{})
+
+			err := s.SendImage(context.Background(), meta, []byte("test image"))
+			if tt.expectErr != "" {
+				if err == nil || err.Error() != tt.expectErr {
+					t.Fatalf("expected error %q, got %v", tt.expectErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Best-effort sends finish in the background
+			deadline := time.Now().Add(time.Second)
+			for archive.received() == "" && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			stats := s.Stats()
+			if tt.archive != nil && (stats[1].Failed != 1 || stats[1].LastError != tt.archive.Error()) {
+				t.Errorf("expected archive failure to be counted, got %+v", stats[1])
+			}
+			if tt.required == nil && stats[0].Sent != 1 {
+				t.Errorf("expected analytics success to be counted, got %+v", stats[0])
+			}
+		})
+	}
+}
+
+func TestMultiSenderSlowBestEffortTarget(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	slow := &mockSender{
+		sendFunc: func(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+			<-release
+			return nil
+		},
+	}
+	fast := &recordingSender{}
+
+	s := NewMultiSender([]Target{
+		{Name: "fast", Sender: fast},
+		{Name: "slow", Sender: slow, Delivery: DeliveryBestEffort, MaxInFlight: 1},
+	}, DefaultRegistry(1, "http://camera"), &testutil.MockLogger{})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := s.SendImage(context.Background(), interfaces.ImageMetadata{CameraID: "camera_1"}, []byte("test image")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("slow best-effort target held up sends for %v", elapsed)
+	}
+
+	if got := fast.received(); got != "camera_1,camera_1,camera_1" {
+		t.Errorf("expected every frame at the fast target, got %q", got)
+	}
+	if stats := s.Stats()[1]; stats.Dropped != 2 {
+		t.Errorf("expected 2 frames dropped at the saturated target, got %+v", stats)
+	}
+}
@@ -0,0 +1,243 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/akhilesharora/turnaround-collector/internal/duration"
+)
+
+const DefaultSnapshotPath = "/snap.jpg"
+
+var (
+	ErrUnknownCamera   = errors.New("unknown camera")
+	ErrDuplicateCamera = errors.New("duplicate camera id")
+)
+
+// Duration is a time.Duration that reads and writes as a string such as "5s" in JSON.
+type Duration = duration.Duration
+
+// CameraConfig describes a single camera endpoint.
+type CameraConfig struct {
+	ID           string   `json:"id"`
+	URL          string   `json:"url"`
+	SnapshotPath string   `json:"snapshot_path"`
+	Timeout      Duration `json:"timeout,omitempty"`
+	Enabled      bool     `json:"enabled"`
+	// PollInterval overrides the collector-wide poll interval for this camera.
+	PollInterval Duration `json:"poll_interval,omitempty"`
+	// Tags group cameras for target routing, e.g. "apron" or "stand_12".
+	Tags []string `json:"tags,omitempty"`
+	// Group names the cameras whose aligned frames share a frame set, such
+	// as all cameras of one stand.
+	Group string `json:"group,omitempty"`
+	// InsecureSkipVerify accepts any certificate from this camera, for
+	// legacy devices with self-signed certificates.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+	// Auth sets the credentials the camera requires, if any.
+	Auth *CameraAuth `json:"auth,omitempty"`
+}
+
+// HasTag reports whether the camera carries any of tags.
+func (c CameraConfig) HasTag(tags ...string) bool {
+	for _, tag := range tags {
+		if slices.Contains(c.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CameraConfig) UnmarshalJSON(data []byte) error {
+	type raw CameraConfig
+	r := raw{SnapshotPath: DefaultSnapshotPath, Enabled: true}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	*c = CameraConfig(r)
+	return nil
+}
+
+func (c CameraConfig) SnapshotURL() string {
+	return strings.TrimRight(c.URL, "/") + "/" + strings.TrimLeft(c.SnapshotPath, "/")
+}
+
+func (c CameraConfig) Validate() error {
+	if c.ID == "" {
+		return errors.New("camera id is required")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("camera %s: invalid url: %w", c.ID, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("camera %s: url must be http or https, got %q", c.ID, c.URL)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("camera %s: timeout must not be negative", c.ID)
+	}
+	if c.PollInterval < 0 {
+		return fmt.Errorf("camera %s: poll interval must not be negative", c.ID)
+	}
+	if c.Auth != nil {
+		if err := c.Auth.Validate(); err != nil {
+			return fmt.Errorf("camera %s: %w", c.ID, err)
+		}
+	}
+	return nil
+}
+
+// Registry holds the set of cameras the collector polls, in declaration order.
+// It is safe for concurrent use and can be swapped in place on reload.
+type Registry struct {
+	mu      sync.RWMutex
+	cameras map[string]CameraConfig
+	order   []string
+}
+
+func NewRegistry(cameras []CameraConfig) (*Registry, error) {
+	r := &Registry{cameras: make(map[string]CameraConfig, len(cameras))}
+	for _, cam := range cameras {
+		if cam.SnapshotPath == "" {
+			cam.SnapshotPath = DefaultSnapshotPath
+		}
+		if err := cam.Validate(); err != nil {
+			return nil, err
+		}
+		if _, exists := r.cameras[cam.ID]; exists {
+			return nil, fmt.Errorf("%w %q", ErrDuplicateCamera, cam.ID)
+		}
+		r.cameras[cam.ID] = cam
+		r.order = append(r.order, cam.ID)
+	}
+	return r, nil
+}
+
+// DefaultRegistry builds count cameras named camera_1..camera_N that all sit
+// behind the same base URL, matching the single CAMERA_BASE_URL setup.
+func DefaultRegistry(count int, baseURL string) *Registry {
+	r := &Registry{cameras: make(map[string]CameraConfig, count)}
+	for i := 1; i <= count; i++ {
+		id := fmt.Sprintf("camera_%d", i)
+		r.cameras[id] = CameraConfig{
+			ID:           id,
+			URL:          baseURL,
+			SnapshotPath: DefaultSnapshotPath,
+			Enabled:      true,
+		}
+		r.order = append(r.order, id)
+	}
+	return r
+}
+
+func ParseRegistry(data []byte) (*Registry, error) {
+	var file struct {
+		Cameras []CameraConfig `json:"cameras"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse camera registry: %w", err)
+	}
+	return NewRegistry(file.Cameras)
+}
+
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read camera registry: %w", err)
+	}
+	return ParseRegistry(data)
+}
+
+// Replace swaps in the cameras of next, so holders of r see the new set.
+func (r *Registry) Replace(next *Registry) {
+	next.mu.RLock()
+	cameras := maps.Clone(next.cameras)
+	order := slices.Clone(next.order)
+	next.mu.RUnlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cameras, r.order = cameras, order
+}
+
+// Add registers a new camera.
+func (r *Registry) Add(cam CameraConfig) error {
+	if cam.SnapshotPath == "" {
+		cam.SnapshotPath = DefaultSnapshotPath
+	}
+	if err := cam.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.cameras[cam.ID]; exists {
+		return fmt.Errorf("%w %q", ErrDuplicateCamera, cam.ID)
+	}
+	r.cameras[cam.ID] = cam
+	r.order = append(r.order, cam.ID)
+	return nil
+}
+
+// Update replaces the settings of an existing camera.
+func (r *Registry) Update(cam CameraConfig) error {
+	if err := cam.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.cameras[cam.ID]; !exists {
+		return fmt.Errorf("%w %q", ErrUnknownCamera, cam.ID)
+	}
+	r.cameras[cam.ID] = cam
+	return nil
+}
+
+// Remove deletes a camera and reports whether it was registered.
+func (r *Registry) Remove(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.cameras[id]; !exists {
+		return false
+	}
+	delete(r.cameras, id)
+	r.order = slices.DeleteFunc(r.order, func(other string) bool { return other == id })
+	return true
+}
+
+func (r *Registry) Get(id string) (CameraConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cam, ok := r.cameras[id]
+	return cam, ok
+}
+
+func (r *Registry) Cameras() []CameraConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cameras := make([]CameraConfig, 0, len(r.order))
+	for _, id := range r.order {
+		cameras = append(cameras, r.cameras[id])
+	}
+	return cameras
+}
+
+func (r *Registry) Enabled() []CameraConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var cameras []CameraConfig
+	for _, id := range r.order {
+		if cam := r.cameras[id]; cam.Enabled {
+			cameras = append(cameras, cam)
+		}
+	}
+	return cameras
+}
@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRegistry(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expectedErr string
+		check       func(t *testing.T, r *Registry)
+	}{
+		{
+			name: "defaults applied",
+			input: `{"cameras": [
+				{"id": "stand_1_nose", "url": "http://10.0.0.5"},
+				{"id": "stand_1_tail", "url": "http://10.0.0.6/", "snapshot_path": "cgi-bin/snapshot.cgi", "timeout": "2s", "enabled": false}
+			]}`,
+			check: func(t *testing.T, r *Registry) {
+				nose, ok := r.Get("stand_1_nose")
+				if !ok {
+					t.Fatal("expected stand_1_nose in registry")
+				}
+				if !nose.Enabled {
+					t.Error("expected camera to be enabled by default")
+				}
+				if got := nose.SnapshotURL(); got != "http://10.0.0.5/snap.jpg" {
+					t.Errorf("unexpected snapshot URL %s", got)
+				}
+
+				tail, _ := r.Get("stand_1_tail")
+				if got := tail.SnapshotURL(); got != "http://10.0.0.6/cgi-bin/snapshot.cgi" {
+					t.Errorf("unexpected snapshot URL %s", got)
+				}
+				if time.Duration(tail.Timeout) != 2*time.Second {
+					t.Errorf("expected 2s timeout, got %v", time.Duration(tail.Timeout))
+				}
+
+				enabled := r.Enabled()
+				if len(enabled) != 1 || enabled[0].ID != "stand_1_nose" {
+					t.Errorf("expected only stand_1_nose enabled, got %+v", enabled)
+				}
+			},
+		},
+		{
+			name:        "duplicate id",
+			input:       `{"cameras": [{"id": "a", "url": "http://a"}, {"id": "a", "url": "http://b"}]}`,
+			expectedErr: "duplicate camera id",
+		},
+		{
+			name:        "missing id",
+			input:       `{"cameras": [{"url": "http://a"}]}`,
+			expectedErr: "camera id is required",
+		},
+		{
+			name:        "invalid scheme",
+			input:       `{"cameras": [{"id": "a", "url": "ftp://a"}]}`,
+			expectedErr: "url must be http or https",
+		},
+		{
+			name:        "invalid timeout",
+			input:       `{"cameras": [{"id": "a", "url": "http://a", "timeout": 5}]}`,
+			expectedErr: "duration must be a string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRegistry([]byte(tt.input))
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.check(t, r)
+		})
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	r := DefaultRegistry(3, "http://camera:8080")
+
+	cameras := r.Cameras()
+	if len(cameras) != 3 {
+		t.Fatalf("expected 3 cameras, got %d", len(cameras))
+	}
+	for i, cam := range cameras {
+		if cam.ID != fmt.Sprintf("camera_%d", i+1) {
+			t.Errorf("unexpected camera id %s at position %d", cam.ID, i)
+		}
+		if cam.SnapshotURL() != "http://camera:8080/snap.jpg" {
+			t.Errorf("unexpected snapshot URL %s", cam.SnapshotURL())
+		}
+	}
+}
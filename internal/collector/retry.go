@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+type RetryPolicy struct {
+	// MaxAttempts includes the first try; values below 2 disable retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Jitter is the fraction (0..1) of each delay that is randomized.
+	Jitter float64
+
+	RetryableStatuses  []int
+	RetryNetworkErrors bool
+	RetryTimeouts      bool
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:        3,
+		BaseDelay:          200 * time.Millisecond,
+		MaxDelay:           5 * time.Second,
+		Jitter:             0.2,
+		RetryableStatuses:  []int{429, 502, 503, 504},
+		RetryNetworkErrors: true,
+		RetryTimeouts:      true,
+	}
+}
+
+// Retryable reports whether err belongs to an error class the policy retries.
+func (p RetryPolicy) Retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return slices.Contains(p.RetryableStatuses, statusErr.StatusCode)
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return p.RetryTimeouts
+	}
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return p.RetryNetworkErrors
+	}
+	return false
+}
+
+// Backoff returns the delay before the given retry (1-based), with jitter applied.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	delay := p.BaseDelay << (retry - 1)
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(p.Jitter * rand.Float64() * float64(delay))
+	}
+	return delay
+}
+
+// Do runs fn until it succeeds, returns a non-retryable error, the attempts
+// are exhausted or ctx is done.
+func (p RetryPolicy) Do(ctx context.Context, logger interfaces.Logger, op, cameraID string, fn func(ctx context.Context) error) error {
+	attempts := max(p.MaxAttempts, 1)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+		if attempt >= attempts || !p.Retryable(err) || ctx.Err() != nil {
+			break
+		}
+
+		delay := p.Backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+			// Never retry sooner than the server asked us to
+			if p.MaxDelay > 0 && statusErr.RetryAfter > p.MaxDelay {
+				return fmt.Errorf("retry-after %v exceeds max delay %v: %w", statusErr.RetryAfter, p.MaxDelay, err)
+			}
+			delay = statusErr.RetryAfter
+		}
+
+		logger.Warn("Attempt failed; retrying",
+			"op", op,
+			logging.KeyCameraID, cameraID,
+			"attempt", attempt,
+			"max_attempts", attempts,
+			"retry_in_ms", delay.Milliseconds(),
+			logging.KeyError, err,
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s retry aborted: %w", op, errors.Join(err, ctx.Err()))
+		case <-timer.C:
+		}
+	}
+
+	if attempts > 1 && p.Retryable(err) {
+		return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+	}
+	return err
+}
+
+type RetryFetcher struct {
+	fetcher interfaces.ImageFetcher
+	policy  RetryPolicy
+	logger  interfaces.Logger
+}
+
+func NewRetryFetcher(fetcher interfaces.ImageFetcher, policy RetryPolicy, logger interfaces.Logger) *RetryFetcher {
+	return &RetryFetcher{
+		fetcher: fetcher,
+		policy:  policy,
+		logger:  logger,
+	}
+}
+
+func (f *RetryFetcher) FetchImage(ctx context.Context, cameraID string) ([]byte, error) {
+	var imageData []byte
+	err := f.policy.Do(ctx, f.logger, opFetch, cameraID, func(ctx context.Context) error {
+		var err error
+		imageData, err = f.fetcher.FetchImage(ctx, cameraID)
+		return err
+	})
+	return imageData, err
+}
+
+type RetrySender struct {
+	sender interfaces.ImageSender
+	policy RetryPolicy
+	logger interfaces.Logger
+}
+
+func NewRetrySender(sender interfaces.ImageSender, policy RetryPolicy, logger interfaces.Logger) *RetrySender {
+	return &RetrySender{
+		sender: sender,
+		policy: policy,
+		logger: logger,
+	}
+}
+
+func (s *RetrySender) SendImage(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+	return s.policy.Do(ctx, s.logger, opSend, meta.CameraID, func(ctx context.Context) error {
+		return s.sender.SendImage(ctx, meta, imageData)
+	})
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	testutil "github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+func TestRetryFetcher(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:        3,
+		BaseDelay:          time.Millisecond,
+		MaxDelay:           50 * time.Millisecond,
+		RetryableStatuses:  []int{503},
+		RetryNetworkErrors: true,
+	}
+
+	tests := []struct {
+		name             string
+		errs             []error
+		expectErr        string
+		expectedAttempts int
+	}{
+		{
+			name:             "succeeds first time",
+			expectedAttempts: 1,
+		},
+		{
+			name:             "recovers from network error",
+			errs:             []error{&net.OpError{Op: "dial", Err: errors.New("connection refused")}},
+			expectedAttempts: 2,
+		},
+		{
+			name:             "retryable status exhausts attempts",
+			errs:             []error{&StatusError{StatusCode: 503}, &StatusError{StatusCode: 503}, &StatusError{StatusCode: 503}},
+			expectErr:        "giving up after 3 attempts",
+			expectedAttempts: 3,
+		},
+		{
+			name:             "non-retryable status",
+			errs:             []error{&StatusError{StatusCode: 404}},
+			expectErr:        "unexpected status: 404",
+			expectedAttempts: 1,
+		},
+		{
+			name:             "honors retry-after",
+			errs:             []error{&StatusError{StatusCode: 503, RetryAfter: 20 * time.Millisecond}},
+			expectedAttempts: 2,
+		},
+		{
+			name:             "retry-after beyond max delay",
+			errs:             []error{&StatusError{StatusCode: 503, RetryAfter: time.Minute}},
+			expectErr:        "exceeds max delay",
+			expectedAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			fetcher := &mockFetcher{
+				fetchFunc: func(ctx context.Context, cameraID string) ([]byte, error) {
+					attempts++
+					if attempts <= len(tt.errs) {
+						return nil, tt.errs[attempts-1]
+					}
+					return []byte("test image"), nil
+				},
+			}
+
+			start := time.Now()
+			data, err := NewRetryFetcher(fetcher, policy, &testutil.MockLogger{}).FetchImage(context.Background(), "camera_1")
+
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectErr, err)
+				}
+			} else if err != nil || string(data) != "test image" {
+				t.Fatalf("expected image, got %q, %v", data, err)
+			}
+
+			if attempts != tt.expectedAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.expectedAttempts, attempts)
+			}
+			if tt.name == "honors retry-after" && time.Since(start) < 20*time.Millisecond {
+				t.Errorf("retried before Retry-After elapsed")
+			}
+		})
+	}
+}
+
+func TestRetrySenderContextCanceled(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:        5,
+		BaseDelay:          time.Second,
+		MaxDelay:           time.Second,
+		RetryNetworkErrors: true,
+	}
+
+	attempts := 0
+	sender := &mockSender{
+		sendFunc: func(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+			attempts++
+			return &net.OpError{Op: "write", Err: errors.New("connection reset")}
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := NewRetrySender(sender, policy, &testutil.MockLogger{}).SendImage(ctx, interfaces.ImageMetadata{CameraID: "camera_1"}, []byte("test image"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt before cancellation, got %d", attempts)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.5}
+
+	for retry, ceiling := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 5: time.Second, 80: time.Second} {
+		delay := policy.Backoff(retry)
+		if delay > ceiling || delay < ceiling/2 {
+			t.Errorf("retry %d: delay %v outside [%v, %v]", retry, delay, ceiling/2, ceiling)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"context"
+	"sync"
+)
+
+// semaphore limits concurrent frames. Unlike a buffered channel its limit
+// can change while frames are in flight; lowering it only delays new
+// acquisitions until enough holders have released.
+type semaphore struct {
+	mu      sync.Mutex
+	limit   int
+	active  int
+	changed chan struct{}
+}
+
+func newSemaphore(limit int) *semaphore {
+	return &semaphore{limit: limit, changed: make(chan struct{})}
+}
+
+func (s *semaphore) Acquire(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if s.active < s.limit {
+			s.active++
+			s.mu.Unlock()
+			return nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *semaphore) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	s.broadcast()
+}
+
+func (s *semaphore) SetLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	s.broadcast()
+}
+
+// broadcast wakes all waiters; callers hold mu.
+func (s *semaphore) broadcast() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
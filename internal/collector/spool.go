@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/spool"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+// SpoolSender decouples fetching from delivery: SendImage only appends the
+// frame to a durable spool and Run drains it into the wrapped sender.
+type SpoolSender struct {
+	spool   *spool.Spool
+	sender  interfaces.ImageSender
+	logger  interfaces.Logger
+	backoff RetryPolicy
+}
+
+func NewSpoolSender(sp *spool.Spool, sender interfaces.ImageSender, logger interfaces.Logger) *SpoolSender {
+	return &SpoolSender{
+		spool:  sp,
+		sender: sender,
+		logger: logger,
+		backoff: RetryPolicy{
+			BaseDelay: time.Second,
+			MaxDelay:  30 * time.Second,
+			Jitter:    0.2,
+		},
+	}
+}
+
+func (s *SpoolSender) SendImage(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+	record, err := encodeSpoolRecord(meta, imageData)
+	if err != nil {
+		return err
+	}
+	return s.spool.Append(record)
+}
+
+// Run delivers spooled frames in order until ctx is canceled. A frame is
+// only acknowledged after the wrapped sender accepted it, so frames in
+// flight during a crash are sent again on the next start.
+func (s *SpoolSender) Run(ctx context.Context) error {
+	failures, readFailures := 0, 0
+	for {
+		rec, err := s.spool.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, spool.ErrClosed) {
+				return ctx.Err()
+			}
+			readFailures++
+			delay := s.backoff.Backoff(readFailures)
+			s.logger.Error("Spool read error", "retry_in_ms", delay.Milliseconds(), logging.KeyError, err)
+			if err := wait(ctx, delay); err != nil {
+				return err
+			}
+			continue
+		}
+		readFailures = 0
+
+		meta, imageData, err := decodeSpoolRecord(rec.Data)
+		if err != nil {
+			// Undecodable records can never be delivered; skip them
+			s.logger.Warn("Dropping undecodable spooled record", logging.KeyError, err)
+			if err := s.spool.Ack(rec); err != nil {
+				s.logger.Error("Spool ack error", logging.KeyError, err)
+			}
+			continue
+		}
+
+		if err := s.sender.SendImage(ctx, meta, imageData); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if rejected(err) {
+				// Retrying would hold up every frame queued behind this one
+				failures = 0
+				s.logger.Warn("Dropping spooled image rejected by the target",
+					logging.KeyCameraID, meta.CameraID,
+					"sequence", meta.Sequence,
+					logging.KeyError, err,
+				)
+				if err := s.spool.Ack(rec); err != nil {
+					s.logger.Error("Spool ack error", logging.KeyError, err)
+				}
+				continue
+			}
+			failures++
+			delay := s.backoff.Backoff(failures)
+			if !errors.Is(err, ErrCircuitOpen) {
+				s.logger.Warn("Spooled image delivery failed",
+					logging.KeyCameraID, meta.CameraID,
+					"sequence", meta.Sequence,
+					"retry_in_ms", delay.Milliseconds(),
+					logging.KeyError, err,
+				)
+			}
+
+			if err := wait(ctx, delay); err != nil {
+				return err
+			}
+			continue
+		}
+
+		failures = 0
+		if err := s.spool.Ack(rec); err != nil {
+			s.logger.Error("Spool ack error", logging.KeyError, err)
+		}
+	}
+}
+
+// rejected reports whether the target refused a frame for good, answering
+// with a client error other than a timeout or rate limit. A joined error is
+// only rejected if every target rejected the frame.
+func rejected(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		for _, err := range errs {
+			if !rejected(err) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	code := statusErr.StatusCode
+	return code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
+
+// wait sleeps for delay or until ctx is done.
+func wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (s *SpoolSender) Stats() spool.Stats {
+	return s.spool.Stats()
+}
+
+// Spool records are a length-prefixed JSON metadata header followed by the image.
+func encodeSpoolRecord(meta interfaces.ImageMetadata, imageData []byte) ([]byte, error) {
+	header, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("encode metadata: %w", err)
+	}
+	record := make([]byte, 4+len(header)+len(imageData))
+	binary.LittleEndian.PutUint32(record, uint32(len(header)))
+	copy(record[4:], header)
+	copy(record[4+len(header):], imageData)
+	return record, nil
+}
+
+func decodeSpoolRecord(record []byte) (interfaces.ImageMetadata, []byte, error) {
+	var meta interfaces.ImageMetadata
+	if len(record) < 4 {
+		return meta, nil, errors.New("spool record too short")
+	}
+	n := int(binary.LittleEndian.Uint32(record))
+	if len(record) < 4+n {
+		return meta, nil, errors.New("spool record header truncated")
+	}
+	if err := json.Unmarshal(record[4:4+n], &meta); err != nil {
+		return meta, nil, fmt.Errorf("decode metadata: %w", err)
+	}
+	return meta, record[4+n:], nil
+}
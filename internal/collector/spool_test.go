@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/spool"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	testutil "github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+func TestSpoolSender(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), spool.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+
+	var (
+		mu        sync.Mutex
+		attempts  int
+		delivered []string
+	)
+	done := make(chan struct{})
+	sender := &mockSender{
+		sendFunc: func(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			// Target is down for the first two attempts
+			if attempts <= 2 {
+				return errors.New("connection refused")
+			}
+			delivered = append(delivered, fmt.Sprintf("%s/%d:%s", meta.CameraID, meta.Sequence, imageData))
+			if len(delivered) == 3 {
+				close(done)
+			}
+			return nil
+		},
+	}
+
+	s := NewSpoolSender(sp, sender, &testutil.MockLogger{})
+	s.backoff = RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i, frame := range []string{"frame-1", "frame-2", "frame-3"} {
+		meta := interfaces.ImageMetadata{CameraID: "camera_1", Sequence: uint64(i + 1)}
+		if err := s.SendImage(ctx, meta, []byte(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.Run(ctx) }()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("spooled frames were not delivered")
+	}
+	cancel()
+	<-runErr
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, want := range []string{"camera_1/1:frame-1", "camera_1/2:frame-2", "camera_1/3:frame-3"} {
+		if delivered[i] != want {
+			t.Errorf("expected %s at position %d, got %s", want, i, delivered[i])
+		}
+	}
+	if pending := s.Stats().Pending; pending != 0 {
+		t.Errorf("expected drained spool, %d bytes pending", pending)
+	}
+}
+
+func TestSpoolSenderRejected(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), spool.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+
+	delivered := make(chan uint64, 2)
+	var retries int
+	sender := &mockSender{
+		sendFunc: func(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+			switch {
+			case meta.Sequence == 1:
+				return &StatusError{StatusCode: http.StatusBadRequest}
+			case meta.Sequence == 2 && retries == 0:
+				// Rejected by one target while another is unavailable: retried
+				retries++
+				return errors.Join(&StatusError{StatusCode: http.StatusBadRequest}, &StatusError{StatusCode: http.StatusServiceUnavailable})
+			}
+			delivered <- meta.Sequence
+			return nil
+		},
+	}
+
+	logger := &testutil.MockLogger{}
+	s := NewSpoolSender(sp, sender, logger)
+	s.backoff = RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for seq := uint64(1); seq <= 3; seq++ {
+		if err := s.SendImage(ctx, interfaces.ImageMetadata{CameraID: "camera_1", Sequence: seq}, []byte("frame")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.Run(ctx) }()
+
+	var got []uint64
+	for len(got) < 2 {
+		select {
+		case seq := <-delivered:
+			got = append(got, seq)
+		case <-time.After(time.Second):
+			t.Fatalf("expected the frames after the rejected one to be delivered, got %v", got)
+		}
+	}
+	cancel()
+	<-runErr
+
+	if fmt.Sprint(got) != "[2 3]" || retries != 1 {
+		t.Errorf("expected frame 2 retried once and frame 3 delivered, got %v after %d retries", got, retries)
+	}
+	if pending := s.Stats().Pending; pending != 0 {
+		t.Errorf("expected drained spool, %d bytes pending", pending)
+	}
+	found := false
+	for _, log := range logger.Snapshot() {
+		found = found || strings.Contains(log, "Dropping spooled image rejected by the target camera_id=camera_1 sequence=1")
+	}
+	if !found {
+		t.Errorf("expected the rejected frame to be logged, got %v", logger.Snapshot())
+	}
+}
@@ -0,0 +1,222 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+// CameraStatus is a snapshot of a camera and how its polling is going.
+type CameraStatus struct {
+	Camera  CameraConfig `json:"camera"`
+	Paused  bool         `json:"paused"`
+	Polling bool         `json:"polling"`
+	// PollInterval is the effective interval, including the collector default.
+	PollInterval Duration `json:"poll_interval"`
+	// AdaptiveInterval is the interval an adaptive poller is currently using.
+	AdaptiveInterval    Duration   `json:"adaptive_interval,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	// ConsecutiveDuplicates counts fetched frames identical to the one before.
+	ConsecutiveDuplicates int  `json:"consecutive_duplicates,omitempty"`
+	Frozen                bool `json:"frozen,omitempty"`
+}
+
+type cameraHealth struct {
+	lastSuccess time.Time
+	lastError   string
+	lastErrorAt time.Time
+	failures    int
+
+	// Content of the last fetched and the last delivered frame
+	lastHash          string
+	duplicates        int
+	frozen            bool
+	deliveredHash     string
+	deliveredSequence uint64
+}
+
+// health returns the record of a camera, creating it if needed. Callers
+// hold statusMu.
+func (c *Collector) health(cameraID string) *cameraHealth {
+	h, ok := c.statuses[cameraID]
+	if !ok {
+		h = &cameraHealth{}
+		c.statuses[cameraID] = h
+	}
+	return h
+}
+
+func (c *Collector) recordStatus(cameraID string, err error) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	h := c.health(cameraID)
+	if err == nil {
+		h.lastSuccess = time.Now()
+		h.failures = 0
+		return
+	}
+	h.lastError = err.Error()
+	h.lastErrorAt = time.Now()
+	h.failures++
+}
+
+// Cameras returns the status of every registered camera in registry order.
+func (c *Collector) Cameras() []CameraStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var statuses []CameraStatus
+	for _, cam := range c.config.Cameras.Cameras() {
+		statuses = append(statuses, c.status(cam))
+	}
+	return statuses
+}
+
+// Camera returns the status of a single camera.
+func (c *Collector) Camera(id string) (CameraStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cam, ok := c.config.Cameras.Get(id)
+	if !ok {
+		return CameraStatus{}, fmt.Errorf("%w %q", ErrUnknownCamera, id)
+	}
+	return c.status(cam), nil
+}
+
+// status builds the status of cam. Callers hold mu.
+func (c *Collector) status(cam CameraConfig) CameraStatus {
+	p, polling := c.pollers[cam.ID]
+	status := CameraStatus{
+		Camera:       cam,
+		Paused:       c.paused[cam.ID],
+		Polling:      polling,
+		PollInterval: Duration(c.config.intervalFor(cam)),
+	}
+	if polling && c.config.Adaptive.Enabled {
+		status.AdaptiveInterval = Duration(p.interval.Load())
+	}
+
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	if h, ok := c.statuses[cam.ID]; ok {
+		if !h.lastSuccess.IsZero() {
+			status.LastSuccess = &h.lastSuccess
+		}
+		if !h.lastErrorAt.IsZero() {
+			status.LastError = h.lastError
+			status.LastErrorAt = &h.lastErrorAt
+		}
+		status.ConsecutiveFailures = h.failures
+		status.ConsecutiveDuplicates = h.duplicates
+		status.Frozen = h.frozen
+	}
+	return status
+}
+
+// Pause stops polling a camera until Resume. A frame in flight is finished.
+func (c *Collector) Pause(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.config.Cameras.Get(id); !ok {
+		return fmt.Errorf("%w %q", ErrUnknownCamera, id)
+	}
+	c.paused[id] = true
+	c.syncPollers()
+	c.logger.Info("Camera paused", logging.KeyCameraID, id)
+	return nil
+}
+
+func (c *Collector) Resume(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.config.Cameras.Get(id); !ok {
+		return fmt.Errorf("%w %q", ErrUnknownCamera, id)
+	}
+	delete(c.paused, id)
+	c.syncPollers()
+	c.logger.Info("Camera resumed", logging.KeyCameraID, id)
+	return nil
+}
+
+// AddCamera registers a camera and starts polling it if it is enabled.
+func (c *Collector) AddCamera(cam CameraConfig) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.config.Cameras.Add(cam); err != nil {
+		return err
+	}
+	c.syncPollers()
+	c.logger.Info("Camera added", logging.KeyCameraID, cam.ID)
+	return nil
+}
+
+// RemoveCamera stops polling a camera and drops it from the registry.
+func (c *Collector) RemoveCamera(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.config.Cameras.Remove(id) {
+		return fmt.Errorf("%w %q", ErrUnknownCamera, id)
+	}
+	delete(c.paused, id)
+	c.syncPollers()
+
+	c.statusMu.Lock()
+	delete(c.statuses, id)
+	c.statusMu.Unlock()
+	cameraFrozen.Delete(id)
+
+	c.logger.Info("Camera removed", logging.KeyCameraID, id)
+	return nil
+}
+
+// SetPollInterval overrides the poll interval of one camera; zero restores
+// the collector default.
+func (c *Collector) SetPollInterval(id string, interval time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cam, ok := c.config.Cameras.Get(id)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownCamera, id)
+	}
+	cam.PollInterval = Duration(interval)
+	if err := c.config.Cameras.Update(cam); err != nil {
+		return err
+	}
+	if p, ok := c.pollers[id]; ok {
+		p.setSchedule(c.config.scheduleFor(cam))
+	}
+	c.logger.Info("Camera poll interval changed", logging.KeyCameraID, id, "poll_interval", c.config.intervalFor(cam))
+	return nil
+}
+
+// Capture fetches and sends a frame from the camera right away, outside its
+// poll schedule. It works for paused and disabled cameras too, and the frame
+// is sent even if it is unchanged; duplicates are marked rather than skipped.
+func (c *Collector) Capture(ctx context.Context, id string) error {
+	if _, ok := c.cameras.Get(id); !ok {
+		return fmt.Errorf("%w %q", ErrUnknownCamera, id)
+	}
+
+	if err := c.sem.Acquire(ctx); err != nil {
+		return err
+	}
+	framesInFlight.With().Inc()
+	_, err := c.processCameraImage(ctx, frameRequest{cameraID: id, requestedAt: time.Now(), manual: true})
+	framesInFlight.With().Dec()
+	c.sem.Release()
+
+	c.recordStatus(id, err)
+	return err
+}
@@ -0,0 +1,194 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/signing"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+)
+
+// limitBody wraps the body of a camera response in the client's size limit.
+func (c *Client) limitBody(resp *http.Response) io.Reader {
+	if c.maxBytes <= 0 {
+		return resp.Body
+	}
+	return &limitReader{r: resp.Body, max: c.maxBytes, declared: resp.ContentLength}
+}
+
+// limitReader fails once more than max bytes were read, or right away when
+// the declared length is already too large.
+type limitReader struct {
+	r        io.Reader
+	max      int64
+	read     int64
+	declared int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.declared > l.max {
+		return 0, invalid(InvalidSize, "response of %d bytes exceeds the limit of %d", l.declared, l.max)
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, invalid(InvalidSize, "response exceeds the limit of %d bytes", l.max)
+	}
+	return n, err
+}
+
+// StreamImage copies a snapshot from the camera straight into a request to
+// the target, without holding the frame in memory. Since the content is
+// only known once it was sent, the content hash travels as a trailer and
+// the frame cannot be retried. Besides the size limit, only the content
+// type and the start-of-image marker are validated.
+func (c *Client) StreamImage(ctx context.Context, meta interfaces.ImageMetadata) (int64, error) {
+	start := time.Now()
+	requestsInFlight.With(opFetch).Inc()
+	requestsInFlight.With(opSend).Inc()
+	defer requestsInFlight.With(opFetch).Dec()
+	defer requestsInFlight.With(opSend).Dec()
+
+	n, err := c.streamImage(ctx, meta)
+	observeRequest(opSend, meta.CameraID, start, int(n), err)
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		invalidImagesTotal.With(meta.CameraID, invalid.Reason).Inc()
+	}
+	if err == nil {
+		c.targetReached.Store(true)
+	}
+	return n, err
+}
+
+func (c *Client) streamImage(ctx context.Context, meta interfaces.ImageMetadata) (int64, error) {
+	cam, ok := c.cameras.Get(meta.CameraID)
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnknownCamera, meta.CameraID)
+	}
+
+	// The camera and the target share one deadline as both connections stay
+	// open for the whole copy
+	timeout := c.timeout
+	if cam.Timeout > 0 {
+		timeout = time.Duration(cam.Timeout)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout+c.timeout)
+		defer cancel()
+	}
+
+	fetchStart := time.Now()
+	resp, err := c.openSnapshot(ctx, cam)
+	observeRequest(opFetch, cam.ID, fetchStart, 0, err)
+	if err != nil {
+		return 0, fmt.Errorf("fetch failed: %w", err)
+	}
+	defer resp.Body.Close()
+	meta.FetchLatency = time.Since(fetchStart)
+
+	if err := checkContentType(resp.Header.Get("Content-Type")); err != nil {
+		return 0, err
+	}
+
+	body := &hashingReader{r: c.limitBody(resp), hash: sha256.New()}
+	// Peek at the start-of-image marker before opening the target request
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(body, soi); err != nil {
+		var invalid *ValidationError
+		if errors.As(err, &invalid) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("fetch failed: %w", err)
+	}
+	if !bytes.Equal(soi, []byte{0xFF, 0xD8}) {
+		return 0, invalid(InvalidMarkers, "missing JPEG start-of-image marker")
+	}
+
+	c.mu.RLock()
+	targetURL := c.targetURL
+	c.mu.RUnlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, io.MultiReader(bytes.NewReader(soi), body))
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	meta.ContentHash = ""
+	meta.SetHeaders(req.Header)
+	req.Header.Set("Content-Type", "image/jpeg")
+	req.ContentLength = -1
+	req.Trailer = http.Header{http.CanonicalHeaderKey(interfaces.HeaderContentHash): nil}
+	if c.signer != nil {
+		c.signer.Stamp(req.Header, time.Now())
+		req.Trailer[http.CanonicalHeaderKey(signing.HeaderSignature)] = nil
+	}
+	body.done = func() {
+		bodyHash := hex.EncodeToString(body.hash.Sum(nil))
+		req.Trailer.Set(interfaces.HeaderContentHash, bodyHash)
+		if c.signer != nil {
+			req.Trailer.Set(signing.HeaderSignature, c.signer.SignatureFor(req.Header, req.Method, req.URL.EscapedPath(), bodyHash))
+		}
+	}
+
+	sendResp, err := c.client.Do(req)
+	n, readErr := body.result()
+	requestBytesTotal.With(opFetch, cam.ID).Add(float64(n))
+	if readErr != nil {
+		// The camera failed mid-frame; report that rather than the aborted send
+		return n, readErr
+	}
+	if err != nil {
+		return n, fmt.Errorf("send image: %w", err)
+	}
+	defer sendResp.Body.Close()
+
+	if sendResp.StatusCode != http.StatusOK && sendResp.StatusCode != http.StatusAccepted {
+		return n, newStatusError(sendResp)
+	}
+	return n, nil
+}
+
+// hashingReader hashes what it reads and calls done at the end of the body,
+// when the trailer can be filled in. The transport may still be reading it
+// after the response arrived, so the outcome is guarded by mu.
+type hashingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	done func()
+
+	mu  sync.Mutex
+	n   int64
+	err error
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	h.mu.Lock()
+	h.n += int64(n)
+	if err != nil && err != io.EOF {
+		h.err = err
+	}
+	h.mu.Unlock()
+	if err == io.EOF && h.done != nil {
+		h.done()
+	}
+	return n, err
+}
+
+// result returns the bytes read so far and the read error, if any.
+func (h *hashingReader) result() (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.n, h.err
+}
@@ -0,0 +1,196 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	testutil "github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+// testCamera serves body as every snapshot, with a Content-Length unless chunked.
+func testCamera(t *testing.T, contentType string, body []byte, chunked bool) *httptest.Server {
+	t.Helper()
+	camera := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		if chunked {
+			w.Write(body[:1])
+			w.(http.Flusher).Flush()
+			w.Write(body[1:])
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(camera.Close)
+	return camera
+}
+
+func TestClientMaxResponseBytes(t *testing.T) {
+	frame := testJPEG(t, 0, 0)
+
+	tests := []struct {
+		name      string
+		maxBytes  int64
+		chunked   bool
+		expectErr bool
+	}{
+		{name: "within limit", maxBytes: int64(len(frame))},
+		{name: "no limit", maxBytes: 0},
+		{name: "declared length too large", maxBytes: int64(len(frame) - 1), expectErr: true},
+		{name: "chunked body too large", maxBytes: int64(len(frame) - 1), chunked: true, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			camera := testCamera(t, "image/jpeg", frame, tt.chunked)
+			cameras, _ := NewRegistry([]CameraConfig{{ID: "limit_cam", URL: camera.URL, Enabled: true}})
+			client := NewClient(time.Second, cameras, "")
+			client.SetMaxResponseBytes(tt.maxBytes)
+
+			data, err := client.FetchImage(context.Background(), "limit_cam")
+			if !tt.expectErr {
+				if err != nil || !bytes.Equal(data, frame) {
+					t.Fatalf("expected the frame, got %d bytes and %v", len(data), err)
+				}
+				return
+			}
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) || invalid.Reason != InvalidSize {
+				t.Errorf("expected a size ValidationError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClientStreamImage(t *testing.T) {
+	frame := testJPEG(t, 0, 0)
+	frameHash := sha256.Sum256(frame)
+
+	tests := []struct {
+		name           string
+		contentType    string
+		body           []byte
+		maxBytes       int64
+		expectedReason string
+	}{
+		{name: "valid frame", contentType: "image/jpeg", body: frame},
+		{name: "HTML error page", contentType: "text/html", body: []byte("<html>busy</html>"), expectedReason: InvalidContentType},
+		{name: "not a JPEG", contentType: "image/jpeg", body: []byte("<html>busy</html>"), expectedReason: InvalidMarkers},
+		{name: "too large", contentType: "image/jpeg", body: frame, maxBytes: 100, expectedReason: InvalidSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			camera := testCamera(t, tt.contentType, tt.body, true)
+
+			received := make(chan interfaces.ImageMetadata, 1)
+			target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				meta, _ := interfaces.MetadataFromHeaders(r.Header)
+				meta.ContentHash = r.Trailer.Get(interfaces.HeaderContentHash)
+				if !bytes.Equal(data, frame) {
+					http.Error(w, "corrupted frame", http.StatusBadRequest)
+					return
+				}
+				received <- meta
+			}))
+			defer target.Close()
+
+			cameras, _ := NewRegistry([]CameraConfig{{ID: "stream_cam", URL: camera.URL, Enabled: true}})
+			client := NewClient(time.Second, cameras, target.URL+"/image")
+			client.SetMaxResponseBytes(tt.maxBytes)
+
+			n, err := client.StreamImage(context.Background(), interfaces.ImageMetadata{CameraID: "stream_cam", Sequence: 3})
+			if tt.expectedReason != "" {
+				var invalid *ValidationError
+				if !errors.As(err, &invalid) || invalid.Reason != tt.expectedReason {
+					t.Fatalf("expected a %s ValidationError, got %v", tt.expectedReason, err)
+				}
+				select {
+				case meta := <-received:
+					t.Errorf("expected the target not to accept the frame, got %+v", meta)
+				default:
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len(frame)) {
+				t.Errorf("expected %d bytes streamed, got %d", len(frame), n)
+			}
+			meta := <-received
+			if meta.Sequence != 3 || meta.ContentHash != hex.EncodeToString(frameHash[:]) {
+				t.Errorf("expected sequence 3 with the frame hash as trailer, got %+v", meta)
+			}
+		})
+	}
+
+	t.Run("dropped connection", func(t *testing.T) {
+		camera := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Header().Set("Content-Length", "1000")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}))
+		defer camera.Close()
+
+		cameras, _ := NewRegistry([]CameraConfig{{ID: "stream_cam", URL: camera.URL, Enabled: true}})
+		client := NewClient(time.Second, cameras, "http://target.invalid/image")
+		_, err := client.StreamImage(context.Background(), interfaces.ImageMetadata{CameraID: "stream_cam"})
+		var invalid *ValidationError
+		if err == nil || errors.As(err, &invalid) {
+			t.Errorf("expected a fetch error rather than an invalid image, got %v", err)
+		}
+	})
+}
+
+type mockStreamer struct {
+	streamed chan interfaces.ImageMetadata
+}
+
+func (m *mockStreamer) StreamImage(ctx context.Context, meta interfaces.ImageMetadata) (int64, error) {
+	m.streamed <- meta
+	return 42, nil
+}
+
+func TestCollectorStreaming(t *testing.T) {
+	fetcher := &mockFetcher{
+		fetchFunc: func(ctx context.Context, cameraID string) ([]byte, error) {
+			t.Error("expected the fetcher not to be used while streaming")
+			return nil, errors.New("unexpected fetch")
+		},
+	}
+	sender := &mockSender{
+		sendFunc: func(ctx context.Context, meta interfaces.ImageMetadata, imageData []byte) error {
+			t.Error("expected the sender not to be used while streaming")
+			return nil
+		},
+	}
+	streamer := &mockStreamer{streamed: make(chan interfaces.ImageMetadata, 1)}
+
+	c := NewCollector(Config{CameraCount: 1, PollInterval: time.Hour}, fetcher, sender, &testutil.MockLogger{})
+	c.SetStreamer(streamer)
+
+	if err := c.Capture(context.Background(), "camera_1"); err != nil {
+		t.Fatal(err)
+	}
+	meta := <-streamer.streamed
+	if meta.CameraID != "camera_1" || meta.Sequence != 1 || meta.IdempotencyKey == "" {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+}
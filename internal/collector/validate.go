@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"image/jpeg"
+	"mime"
+)
+
+// ImageLimits bounds the frames a camera may return. Zero fields are not
+// checked. The maximum size is enforced while reading, see
+// Client.SetMaxResponseBytes.
+type ImageLimits struct {
+	MinBytes  int64
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+}
+
+// Reasons a fetched payload is rejected, used as the reason metric label.
+const (
+	InvalidContentType = "content_type"
+	InvalidSize        = "size"
+	InvalidMarkers     = "markers"
+	InvalidDecode      = "decode"
+	InvalidDimensions  = "dimensions"
+)
+
+// ValidationError reports a payload that the camera returned successfully
+// but that is not an acceptable JPEG, such as an HTML error page or a
+// truncated frame. It is never retried.
+type ValidationError struct {
+	Reason string
+	Detail string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid image: " + e.Detail
+}
+
+func invalid(reason, format string, args ...any) error {
+	return &ValidationError{Reason: reason, Detail: fmt.Sprintf(format, args...)}
+}
+
+// ValidateImage checks that data, served with contentType, is a complete
+// JPEG within limits. An empty content type is not checked.
+func ValidateImage(contentType string, data []byte, limits ImageLimits) error {
+	if err := checkContentType(contentType); err != nil {
+		return err
+	}
+
+	size := int64(len(data))
+	if limits.MinBytes > 0 && size < limits.MinBytes {
+		return invalid(InvalidSize, "%d bytes is below the minimum of %d", size, limits.MinBytes)
+	}
+
+	// Every JPEG starts with SOI (FF D8) and a truncated one lacks the EOI
+	// (FF D9) at the end
+	if !bytes.HasPrefix(data, []byte{0xFF, 0xD8}) {
+		return invalid(InvalidMarkers, "missing JPEG start-of-image marker")
+	}
+	if !bytes.HasSuffix(data, []byte{0xFF, 0xD9}) {
+		return invalid(InvalidMarkers, "missing JPEG end-of-image marker; frame truncated?")
+	}
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return invalid(InvalidDecode, "decode JPEG header: %v", err)
+	}
+	switch {
+	case cfg.Width < limits.MinWidth:
+		return invalid(InvalidDimensions, "width %d is below the minimum of %d", cfg.Width, limits.MinWidth)
+	case cfg.Height < limits.MinHeight:
+		return invalid(InvalidDimensions, "height %d is below the minimum of %d", cfg.Height, limits.MinHeight)
+	case limits.MaxWidth > 0 && cfg.Width > limits.MaxWidth:
+		return invalid(InvalidDimensions, "width %d exceeds the maximum of %d", cfg.Width, limits.MaxWidth)
+	case limits.MaxHeight > 0 && cfg.Height > limits.MaxHeight:
+		return invalid(InvalidDimensions, "height %d exceeds the maximum of %d", cfg.Height, limits.MaxHeight)
+	}
+	return nil
+}
+
+// checkContentType accepts JPEG content types and an empty one.
+func checkContentType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != "image/jpeg" && mediaType != "image/jpg") {
+		return invalid(InvalidContentType, "unexpected content type %q", contentType)
+	}
+	return nil
+}
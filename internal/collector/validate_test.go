@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidateImage(t *testing.T) {
+	frame := testJPEG(t, 0, 0) // 64x48
+
+	tests := []struct {
+		name           string
+		contentType    string
+		data           []byte
+		limits         ImageLimits
+		expectedReason string
+	}{
+		{name: "valid frame", contentType: "image/jpeg", data: frame},
+		{name: "content type with parameters", contentType: "image/jpeg; charset=binary", data: frame},
+		{name: "no content type", data: frame},
+		{
+			name:           "HTML error page",
+			contentType:    "text/html; charset=utf-8",
+			data:           []byte("<html>camera busy</html>"),
+			expectedReason: InvalidContentType,
+		},
+		{
+			name:           "not a JPEG",
+			data:           []byte("<html>camera busy</html>"),
+			expectedReason: InvalidMarkers,
+		},
+		{
+			name:           "truncated frame",
+			contentType:    "image/jpeg",
+			data:           frame[:len(frame)/2],
+			expectedReason: InvalidMarkers,
+		},
+		{
+			name:           "markers without a JPEG",
+			contentType:    "image/jpeg",
+			data:           []byte{0xFF, 0xD8, 0xFF, 0xE0, 0xFF, 0xD9},
+			expectedReason: InvalidDecode,
+		},
+		{
+			name:           "too small",
+			data:           frame,
+			limits:         ImageLimits{MinBytes: int64(len(frame) + 1)},
+			expectedReason: InvalidSize,
+		},
+		{
+			name:           "below minimum dimensions",
+			data:           frame,
+			limits:         ImageLimits{MinWidth: 640, MinHeight: 480},
+			expectedReason: InvalidDimensions,
+		},
+		{
+			name:           "above maximum height",
+			data:           frame,
+			limits:         ImageLimits{MaxHeight: 32},
+			expectedReason: InvalidDimensions,
+		},
+		{
+			name:   "within dimensions",
+			data:   frame,
+			limits: ImageLimits{MinWidth: 64, MinHeight: 48, MaxWidth: 64, MaxHeight: 48},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateImage(tt.contentType, tt.data, tt.limits)
+			if tt.expectedReason == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("expected a ValidationError, got %v", err)
+			}
+			if invalid.Reason != tt.expectedReason {
+				t.Errorf("expected reason %q, got %q (%v)", tt.expectedReason, invalid.Reason, err)
+			}
+		})
+	}
+}
+
+func TestClientImageValidation(t *testing.T) {
+	camera := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "camera busy", http.StatusOK)
+	}))
+	defer camera.Close()
+
+	cameras, _ := NewRegistry([]CameraConfig{{ID: "busy_cam", URL: camera.URL, Enabled: true}})
+	client := NewClient(time.Second, cameras, "")
+	client.SetImageValidation(ImageLimits{})
+
+	_, err := client.FetchImage(context.Background(), "busy_cam")
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || invalid.Reason != InvalidContentType {
+		t.Fatalf("expected a content type ValidationError, got %v", err)
+	}
+	if got := invalidImagesTotal.With("busy_cam", InvalidContentType).Value(); got != 1 {
+		t.Errorf("expected 1 invalid image counted, got %v", got)
+	}
+	if got := requestErrorsTotal.With(opFetch, "busy_cam").Value(); got != 0 {
+		t.Errorf("expected invalid image not to count as a request error, got %v", got)
+	}
+	if DefaultRetryPolicy().Retryable(err) {
+		t.Error("expected invalid images not to be retried")
+	}
+}
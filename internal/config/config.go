@@ -0,0 +1,493 @@
+// Package config loads the collector configuration from a JSON file,
+// environment variables and command-line flags, in increasing precedence.
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/collector"
+	"github.com/akhilesharora/turnaround-collector/internal/signing"
+	"github.com/akhilesharora/turnaround-collector/internal/spool"
+	"github.com/akhilesharora/turnaround-collector/internal/tlsutil"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+type Config struct {
+	// CameraCount and CameraBaseURL describe the default camera set used
+	// when no cameras are listed explicitly.
+	CameraCount   int                      `json:"camera_count"`
+	CameraBaseURL string                   `json:"camera_base_url"`
+	Cameras       []collector.CameraConfig `json:"cameras,omitempty"`
+	// CameraAuth applies to every camera without auth of its own; an empty
+	// scheme means none.
+	CameraAuth collector.CameraAuth `json:"camera_auth"`
+
+	PollInterval  collector.Duration `json:"poll_interval"`
+	MaxConcurrent int                `json:"max_concurrent"`
+	// AlignPolls fires cameras on wall-clock multiples of their poll interval.
+	AlignPolls bool           `json:"align_polls,omitempty"`
+	Adaptive   AdaptiveConfig `json:"adaptive"`
+	// DuplicateFrames handles frames identical to the last one delivered:
+	// send, mark or skip them.
+	DuplicateFrames collector.DuplicatePolicy `json:"duplicate_frames"`
+	// FrozenAfter consecutive identical frames report a camera frozen; 0 disables it.
+	FrozenAfter int    `json:"frozen_after"`
+	TargetURL   string `json:"target_url"`
+	// Targets fans frames out to several sinks; when empty every frame goes to TargetURL.
+	Targets []TargetConfig `json:"targets,omitempty"`
+	// RequestTimeout applies to target sends and to cameras without their own timeout.
+	RequestTimeout collector.Duration `json:"request_timeout"`
+
+	// MaxImageBytes bounds camera responses; larger ones are rejected. 0
+	// means unlimited.
+	MaxImageBytes int64 `json:"max_image_bytes"`
+	// Stream pipes camera responses into target requests without buffering
+	// them, at the cost of retries, the spool, fan-out and frame analysis.
+	Stream          bool                  `json:"stream,omitempty"`
+	ImageValidation ImageValidationConfig `json:"image_validation"`
+
+	Retry   RetryConfig   `json:"retry"`
+	Breaker BreakerConfig `json:"breaker"`
+	Spool   SpoolConfig   `json:"spool"`
+	TLS     TLSConfig     `json:"tls"`
+	// TargetAuth signs deliveries with an API key; an empty key_id means
+	// they are sent unsigned.
+	TargetAuth TargetAuthConfig `json:"target_auth"`
+	Admin      AdminConfig      `json:"admin"`
+	Log        LogConfig        `json:"log"`
+}
+
+type AdaptiveConfig struct {
+	Enabled     bool               `json:"enabled"`
+	MinInterval collector.Duration `json:"min_interval"`
+	MaxInterval collector.Duration `json:"max_interval"`
+	// ChangeThreshold is the fraction of perceptual hash bits that must
+	// differ for a frame to count as a scene change.
+	ChangeThreshold float64 `json:"change_threshold"`
+}
+
+// ImageValidationConfig bounds the frames accepted from cameras. Zero
+// limits are not checked.
+type ImageValidationConfig struct {
+	Enabled   bool  `json:"enabled"`
+	MinBytes  int64 `json:"min_bytes"`
+	MinWidth  int   `json:"min_width"`
+	MinHeight int   `json:"min_height"`
+	MaxWidth  int   `json:"max_width"`
+	MaxHeight int   `json:"max_height"`
+}
+
+type TargetConfig struct {
+	Name     string                   `json:"name"`
+	URL      string                   `json:"url"`
+	Delivery collector.DeliveryPolicy `json:"delivery,omitempty"`
+	// Cameras and Tags restrict the target to matching cameras; empty means all.
+	Cameras     []string `json:"cameras,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	MaxInFlight int      `json:"max_in_flight,omitempty"`
+}
+
+type RetryConfig struct {
+	MaxAttempts        int                `json:"max_attempts"`
+	BaseDelay          collector.Duration `json:"base_delay"`
+	MaxDelay           collector.Duration `json:"max_delay"`
+	Jitter             float64            `json:"jitter"`
+	RetryableStatuses  []int              `json:"retryable_statuses"`
+	RetryNetworkErrors bool               `json:"retry_network_errors"`
+	RetryTimeouts      bool               `json:"retry_timeouts"`
+}
+
+type BreakerConfig struct {
+	FailureThreshold int                `json:"failure_threshold"`
+	Cooldown         collector.Duration `json:"cooldown"`
+}
+
+type SpoolConfig struct {
+	// Dir enables the spool when set.
+	Dir      string               `json:"dir,omitempty"`
+	MaxBytes int64                `json:"max_bytes"`
+	MaxAge   collector.Duration   `json:"max_age"`
+	Eviction spool.EvictionPolicy `json:"eviction"`
+}
+
+type TLSConfig struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string `json:"ca_file,omitempty"`
+	// CertFile and KeyFile hold the client certificate presented to servers.
+	CertFile           string `json:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// TargetAuthConfig names the API key the collector signs deliveries with.
+// Like camera secrets, the key's secret is read from SecretFile or the
+// environment variable SecretEnv.
+type TargetAuthConfig struct {
+	KeyID      string `json:"key_id,omitempty"`
+	SecretFile string `json:"secret_file,omitempty"`
+	SecretEnv  string `json:"secret_env,omitempty"`
+}
+
+type AdminConfig struct {
+	// Addr is the admin listen address; empty disables the admin server.
+	Addr                  string  `json:"addr"`
+	ReadySuccessThreshold float64 `json:"ready_success_threshold"`
+	ReadyMinSamples       int     `json:"ready_min_samples"`
+	// Token enables the camera management API, which requires it as a bearer token.
+	Token string `json:"token,omitempty"`
+}
+
+type LogConfig struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+}
+
+func Default() Config {
+	policy := collector.DefaultRetryPolicy()
+	breaker := collector.DefaultBreakerConfig()
+
+	return Config{
+		CameraCount:     3,
+		CameraBaseURL:   "http://camera",
+		PollInterval:    collector.Duration(5 * time.Second),
+		TargetURL:       "http://target:8080/image",
+		RequestTimeout:  collector.Duration(5 * time.Second),
+		DuplicateFrames: collector.DuplicatesSend,
+		Adaptive: AdaptiveConfig{
+			MinInterval:     collector.Duration(time.Second),
+			MaxInterval:     collector.Duration(30 * time.Second),
+			ChangeThreshold: 0.05,
+		},
+		Retry: RetryConfig{
+			MaxAttempts:        policy.MaxAttempts,
+			BaseDelay:          collector.Duration(policy.BaseDelay),
+			MaxDelay:           collector.Duration(policy.MaxDelay),
+			Jitter:             policy.Jitter,
+			RetryableStatuses:  policy.RetryableStatuses,
+			RetryNetworkErrors: policy.RetryNetworkErrors,
+			RetryTimeouts:      policy.RetryTimeouts,
+		},
+		Breaker: BreakerConfig{
+			FailureThreshold: breaker.FailureThreshold,
+			Cooldown:         collector.Duration(breaker.Cooldown),
+		},
+		Spool: SpoolConfig{
+			Eviction: spool.DropOldest,
+		},
+		Admin: AdminConfig{
+			Addr:                  ":9090",
+			ReadySuccessThreshold: 0.5,
+			ReadyMinSamples:       10,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: logging.FormatText,
+		},
+	}
+}
+
+// Load reads a JSON config file on top of the defaults. Unknown fields are
+// rejected so that typos do not silently fall back to defaults.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("read config: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate reports every problem with the configuration at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if len(c.Cameras) == 0 {
+		check(c.CameraCount >= 1, "camera_count must be at least 1 when no cameras are listed, got %d", c.CameraCount)
+		if err := validateURL(c.CameraBaseURL); err != nil {
+			errs = append(errs, fmt.Errorf("camera_base_url: %w", err))
+		}
+	} else if _, err := collector.NewRegistry(c.Cameras); err != nil {
+		errs = append(errs, fmt.Errorf("cameras: %w", err))
+	}
+	if c.CameraAuth.Scheme != "" {
+		if err := c.CameraAuth.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("camera_auth: %w", err))
+		}
+	}
+
+	check(c.PollInterval > 0, "poll_interval must be positive, got %s", time.Duration(c.PollInterval))
+	if c.Adaptive.Enabled {
+		check(c.Adaptive.MinInterval > 0, "adaptive.min_interval must be positive, got %s", time.Duration(c.Adaptive.MinInterval))
+		check(c.Adaptive.MaxInterval >= c.Adaptive.MinInterval, "adaptive.max_interval (%s) must not be below adaptive.min_interval (%s)",
+			time.Duration(c.Adaptive.MaxInterval), time.Duration(c.Adaptive.MinInterval))
+		check(c.Adaptive.ChangeThreshold >= 0 && c.Adaptive.ChangeThreshold <= 1,
+			"adaptive.change_threshold must be between 0 and 1, got %v", c.Adaptive.ChangeThreshold)
+	}
+	if _, err := collector.ParseDuplicatePolicy(string(c.DuplicateFrames)); err != nil {
+		errs = append(errs, fmt.Errorf("duplicate_frames: %w", err))
+	}
+	check(c.FrozenAfter >= 0, "frozen_after must not be negative, got %d", c.FrozenAfter)
+	check(c.MaxConcurrent >= 0, "max_concurrent must not be negative, got %d", c.MaxConcurrent)
+	if len(c.Targets) == 0 {
+		if err := validateURL(c.TargetURL); err != nil {
+			errs = append(errs, fmt.Errorf("target_url: %w", err))
+		}
+	}
+	names := make(map[string]bool)
+	for i, t := range c.Targets {
+		switch {
+		case t.Name == "":
+			errs = append(errs, fmt.Errorf("targets[%d]: name is required", i))
+		case names[t.Name]:
+			errs = append(errs, fmt.Errorf("targets[%d]: duplicate name %q", i, t.Name))
+		}
+		names[t.Name] = true
+		if err := validateURL(t.URL); err != nil {
+			errs = append(errs, fmt.Errorf("targets[%d].url: %w", i, err))
+		}
+		if t.Delivery != "" {
+			if _, err := collector.ParseDeliveryPolicy(string(t.Delivery)); err != nil {
+				errs = append(errs, fmt.Errorf("targets[%d].delivery: %w", i, err))
+			}
+		}
+		check(t.MaxInFlight >= 0, "targets[%d].max_in_flight must not be negative", i)
+	}
+	check(c.RequestTimeout > 0, "request_timeout must be positive, got %s", time.Duration(c.RequestTimeout))
+
+	v := c.ImageValidation
+	check(v.MinBytes >= 0, "image_validation.min_bytes must not be negative")
+	check(v.MinWidth >= 0 && v.MinHeight >= 0 && v.MaxWidth >= 0 && v.MaxHeight >= 0,
+		"image_validation dimensions must not be negative")
+	check(c.MaxImageBytes >= 0, "max_image_bytes must not be negative")
+	check(c.MaxImageBytes == 0 || c.MaxImageBytes >= v.MinBytes,
+		"max_image_bytes (%d) must not be below image_validation.min_bytes (%d)", c.MaxImageBytes, v.MinBytes)
+	if c.Stream {
+		check(len(c.Targets) == 0, "stream cannot be combined with targets")
+		check(c.Spool.Dir == "", "stream cannot be combined with spool.dir")
+		check(!c.Adaptive.Enabled, "stream cannot be combined with adaptive polling")
+	}
+	check(v.MaxWidth == 0 || v.MaxWidth >= v.MinWidth, "image_validation.max_width (%d) must not be below min_width (%d)", v.MaxWidth, v.MinWidth)
+	check(v.MaxHeight == 0 || v.MaxHeight >= v.MinHeight, "image_validation.max_height (%d) must not be below min_height (%d)", v.MaxHeight, v.MinHeight)
+
+	check(c.Retry.MaxAttempts >= 1, "retry.max_attempts must be at least 1, got %d", c.Retry.MaxAttempts)
+	check(c.Retry.BaseDelay >= 0, "retry.base_delay must not be negative")
+	check(c.Retry.MaxDelay >= c.Retry.BaseDelay, "retry.max_delay (%s) must not be below retry.base_delay (%s)",
+		time.Duration(c.Retry.MaxDelay), time.Duration(c.Retry.BaseDelay))
+	check(c.Retry.Jitter >= 0 && c.Retry.Jitter <= 1, "retry.jitter must be between 0 and 1, got %v", c.Retry.Jitter)
+	for _, status := range c.Retry.RetryableStatuses {
+		check(status >= 100 && status <= 599, "retry.retryable_statuses: %d is not an HTTP status", status)
+	}
+
+	check(c.Breaker.FailureThreshold >= 1, "breaker.failure_threshold must be at least 1, got %d", c.Breaker.FailureThreshold)
+	check(c.Breaker.Cooldown >= 0, "breaker.cooldown must not be negative")
+
+	check(c.Spool.MaxBytes >= 0, "spool.max_bytes must not be negative")
+	check(c.Spool.MaxAge >= 0, "spool.max_age must not be negative")
+	if _, err := spool.ParseEvictionPolicy(string(c.Spool.Eviction)); err != nil {
+		errs = append(errs, fmt.Errorf("spool.eviction: %w", err))
+	}
+
+	if _, _, err := c.TLS.Build(); err != nil {
+		errs = append(errs, fmt.Errorf("tls: %w", err))
+	}
+	if _, err := c.TargetAuth.Key(); err != nil {
+		errs = append(errs, fmt.Errorf("target_auth: %w", err))
+	}
+
+	check(c.Admin.ReadySuccessThreshold >= 0 && c.Admin.ReadySuccessThreshold <= 1,
+		"admin.ready_success_threshold must be between 0 and 1, got %v", c.Admin.ReadySuccessThreshold)
+	check(c.Admin.ReadyMinSamples >= 0, "admin.ready_min_samples must not be negative")
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %w", err))
+	}
+	if _, err := logging.New(io.Discard, c.Log.Format, slog.LevelInfo); err != nil {
+		errs = append(errs, fmt.Errorf("log.format: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("must be an http or https URL, got %q", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host in %q", raw)
+	}
+	return nil
+}
+
+// Collector returns the collector settings, including the camera registry.
+func (c Config) Collector() (collector.Config, error) {
+	cameras := c.Cameras
+	if len(cameras) == 0 {
+		cameras = collector.DefaultRegistry(c.CameraCount, c.CameraBaseURL).Cameras()
+	}
+	if c.CameraAuth.Scheme != "" {
+		cameras = slices.Clone(cameras)
+		for i := range cameras {
+			if cameras[i].Auth == nil {
+				cameras[i].Auth = &c.CameraAuth
+			}
+		}
+	}
+	registry, err := collector.NewRegistry(cameras)
+	if err != nil {
+		return collector.Config{}, err
+	}
+
+	return collector.Config{
+		CameraCount:   len(registry.Cameras()),
+		PollInterval:  time.Duration(c.PollInterval),
+		MaxConcurrent: c.MaxConcurrent,
+		AlignPolls:    c.AlignPolls,
+		Duplicates:    c.DuplicateFrames,
+		FrozenAfter:   c.FrozenAfter,
+		Adaptive: collector.AdaptiveConfig{
+			Enabled:         c.Adaptive.Enabled,
+			MinInterval:     time.Duration(c.Adaptive.MinInterval),
+			MaxInterval:     time.Duration(c.Adaptive.MaxInterval),
+			ChangeThreshold: c.Adaptive.ChangeThreshold,
+		},
+		CameraBaseURL: c.CameraBaseURL,
+		TargetURL:     c.TargetURL,
+		Cameras:       registry,
+	}, nil
+}
+
+// Route returns the cameras the target receives frames from.
+func (t TargetConfig) Route() collector.Route {
+	return collector.Route{Cameras: t.Cameras, Tags: t.Tags}
+}
+
+func (v ImageValidationConfig) Limits() collector.ImageLimits {
+	return collector.ImageLimits{
+		MinBytes:  v.MinBytes,
+		MinWidth:  v.MinWidth,
+		MinHeight: v.MinHeight,
+		MaxWidth:  v.MaxWidth,
+		MaxHeight: v.MaxHeight,
+	}
+}
+
+func (r RetryConfig) Policy() collector.RetryPolicy {
+	return collector.RetryPolicy{
+		MaxAttempts:        r.MaxAttempts,
+		BaseDelay:          time.Duration(r.BaseDelay),
+		MaxDelay:           time.Duration(r.MaxDelay),
+		Jitter:             r.Jitter,
+		RetryableStatuses:  r.RetryableStatuses,
+		RetryNetworkErrors: r.RetryNetworkErrors,
+		RetryTimeouts:      r.RetryTimeouts,
+	}
+}
+
+func (b BreakerConfig) Breaker() collector.BreakerConfig {
+	return collector.BreakerConfig{
+		FailureThreshold: b.FailureThreshold,
+		Cooldown:         time.Duration(b.Cooldown),
+	}
+}
+
+func (s SpoolConfig) Options() spool.Options {
+	return spool.Options{
+		MaxBytes: s.MaxBytes,
+		MaxAge:   time.Duration(s.MaxAge),
+		Eviction: s.Eviction,
+	}
+}
+
+// Logger builds the logger for service writing to stdout.
+func (l LogConfig) Logger(service string) (*slog.Logger, error) {
+	level, err := logging.ParseLevel(l.Level)
+	if err != nil {
+		return nil, err
+	}
+	logger, err := logging.New(os.Stdout, l.Format, level)
+	if err != nil {
+		return nil, err
+	}
+	return logger.With(logging.KeyService, service), nil
+}
+
+// Build returns the client TLS configuration, or nil when nothing is
+// configured. The returned keypair, if any, holds the client certificate
+// and can be watched for rotation.
+func (t TLSConfig) Build() (*tls.Config, *tlsutil.Keypair, error) {
+	if t.CAFile == "" && t.CertFile == "" && t.KeyFile == "" && !t.InsecureSkipVerify {
+		return nil, nil, nil
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, nil, errors.New("cert_file and key_file must be set together")
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile != "" {
+		pool, err := tlsutil.LoadCertPool(t.CAFile, true)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ca_file: %w", err)
+		}
+		cfg.RootCAs = pool
+	}
+	var keypair *tlsutil.Keypair
+	if t.CertFile != "" {
+		var err error
+		keypair, err = tlsutil.NewKeypair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("client certificate: %w", err)
+		}
+		cfg.GetClientCertificate = keypair.GetClientCertificate
+	}
+	return cfg, keypair, nil
+}
+
+// Key returns the signing key, or nil when no key_id is configured.
+func (t TargetAuthConfig) Key() (*signing.Key, error) {
+	if t.KeyID == "" {
+		if t.SecretFile != "" || t.SecretEnv != "" {
+			return nil, errors.New("a secret requires key_id")
+		}
+		return nil, nil
+	}
+	if (t.SecretFile == "") == (t.SecretEnv == "") {
+		return nil, errors.New("key_id requires exactly one of secret_file and secret_env")
+	}
+	secret, err := collector.ReadSecret(t.SecretFile, t.SecretEnv)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, errors.New("the key secret is empty")
+	}
+	return &signing.Key{ID: t.KeyID, Secret: secret}, nil
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/collector"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "collector.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		expectErr string
+		check     func(t *testing.T, cfg Config)
+	}{
+		{
+			name: "overrides defaults",
+			content: `{
+				"poll_interval": "2s",
+				"target_url": "https://target.example/image",
+				"retry": {"max_attempts": 5},
+				"cameras": [{"id": "dock", "url": "http://dock"}]
+			}`,
+			check: func(t *testing.T, cfg Config) {
+				if cfg.PollInterval != collector.Duration(2*time.Second) {
+					t.Errorf("expected poll interval 2s, got %s", time.Duration(cfg.PollInterval))
+				}
+				if cfg.Retry.MaxAttempts != 5 || cfg.Retry.MaxDelay != collector.Duration(5*time.Second) {
+					t.Errorf("expected partial retry override, got %+v", cfg.Retry)
+				}
+				if len(cfg.Cameras) != 1 || !cfg.Cameras[0].Enabled {
+					t.Errorf("unexpected cameras %+v", cfg.Cameras)
+				}
+				if cfg.Admin.Addr != ":9090" {
+					t.Errorf("expected default admin addr, got %q", cfg.Admin.Addr)
+				}
+			},
+		},
+		{
+			name:      "unknown field",
+			content:   `{"poll_intervall": "2s"}`,
+			expectErr: `unknown field "poll_intervall"`,
+		},
+		{
+			name:      "malformed duration",
+			content:   `{"poll_interval": 5}`,
+			expectErr: "duration must be a string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeFile(t, tt.content))
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestOverridePrecedence(t *testing.T) {
+	cfg, err := Load(writeFile(t, `{"poll_interval": "2s", "max_concurrent": 2, "camera_count": 4}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{"POLL_INTERVAL": "3s", "MAX_CONCURRENT": "3"}
+	if err := cfg.ApplyEnv(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterFlags(fs)
+	if err := fs.Parse([]string{"-max-concurrent", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := flags.Apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.CameraCount != 4 {
+		t.Errorf("expected camera count from file, got %d", cfg.CameraCount)
+	}
+	if cfg.PollInterval != collector.Duration(3*time.Second) {
+		t.Errorf("expected poll interval from env, got %s", time.Duration(cfg.PollInterval))
+	}
+	if cfg.MaxConcurrent != 1 {
+		t.Errorf("expected max concurrent from flag, got %d", cfg.MaxConcurrent)
+	}
+}
+
+func TestApplyEnvRejectsMalformedValues(t *testing.T) {
+	cfg := Default()
+	err := cfg.ApplyEnv(func(key string) (string, bool) {
+		if key == "CAMERA_COUNT" {
+			return "three", true
+		}
+		return "", false
+	})
+	if err == nil || !strings.Contains(err.Error(), `CAMERA_COUNT: invalid integer "three"`) {
+		t.Fatalf("expected CAMERA_COUNT error, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("expected defaults to be valid, got %v", err)
+	}
+
+	cfg := Default()
+	cfg.PollInterval = 0
+	cfg.TargetURL = "target:8080"
+	cfg.Retry.BaseDelay = collector.Duration(time.Second)
+	cfg.Retry.MaxDelay = collector.Duration(time.Millisecond)
+	cfg.DuplicateFrames = "drop"
+	cfg.ImageValidation.MinWidth = 16
+	cfg.ImageValidation.MaxWidth = 8
+	cfg.Stream = true
+	cfg.Spool.Dir = "/var/spool/collector"
+	cfg.Adaptive.Enabled = true
+	cfg.Adaptive.ChangeThreshold = 1.5
+	cfg.Spool.Eviction = "drop-random"
+	cfg.TLS.CertFile = "client.pem"
+	cfg.CameraAuth = collector.CameraAuth{Scheme: collector.AuthDigest, SecretEnv: "CAMERA_PASSWORD"}
+	cfg.TargetAuth = TargetAuthConfig{SecretFile: "key.secret"}
+	cfg.Log.Level = "verbose"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		"poll_interval must be positive",
+		"target_url:",
+		"retry.max_delay (1ms) must not be below retry.base_delay (1s)",
+		"duplicate_frames: unknown duplicate policy",
+		"adaptive.change_threshold must be between 0 and 1",
+		"image_validation.max_width (8) must not be below min_width (16)",
+		"stream cannot be combined with spool.dir",
+		"spool.eviction:",
+		"tls: cert_file and key_file must be set together",
+		"camera_auth: digest auth requires a username",
+		"target_auth: a secret requires key_id",
+		"log.level:",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q, got:\n%v", expected, err)
+		}
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	cfg := Default()
+	next := Default()
+	next.PollInterval = collector.Duration(time.Second)
+	next.TargetURL = "http://other:8080/image"
+	next.Retry.MaxAttempts = 7
+	next.Log.Format = "json"
+
+	changed := cfg.RestartRequired(next)
+	if strings.Join(changed, ",") != "retry,log" {
+		t.Errorf("expected retry and log to need a restart, got %v", changed)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := writeFile(t, `{}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan struct{}, 1)
+	go Watch(ctx, path, 5*time.Millisecond, func() { changes <- struct{}{} })
+
+	time.Sleep(20 * time.Millisecond)
+	if err := os.WriteFile(path, []byte(`{"poll_interval": "1s"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("expected change to be detected")
+	}
+}
+
+func TestValidateTargets(t *testing.T) {
+	cfg := Default()
+	cfg.TargetURL = ""
+	if err := cfg.ApplyEnv(func(key string) (string, bool) {
+		if key == "TARGETS" {
+			return `[
+				{"name": "analytics", "url": "http://analytics/image"},
+				{"name": "analytics", "url": "ftp://archive", "delivery": "sometimes"}
+			]`, true
+		}
+		return "", false
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		`targets[1]: duplicate name "analytics"`,
+		"targets[1].url:",
+		`targets[1].delivery: unknown delivery policy "sometimes"`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q, got:\n%v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "target_url") {
+		t.Errorf("expected target_url to be ignored when targets are set, got:\n%v", err)
+	}
+}
+
+func TestCollectorCameraAuth(t *testing.T) {
+	t.Setenv("CAMERA_PASSWORD", "s3cret")
+	own := &collector.CameraAuth{Scheme: collector.AuthBearer, SecretEnv: "CAMERA_PASSWORD"}
+
+	cfg := Default()
+	cfg.CameraAuth = collector.CameraAuth{Scheme: collector.AuthDigest, Username: "admin", SecretEnv: "CAMERA_PASSWORD"}
+	cfg.Cameras = []collector.CameraConfig{
+		{ID: "gate_a", URL: "http://10.0.0.1", Enabled: true},
+		{ID: "gate_b", URL: "http://10.0.0.2", Enabled: true, Auth: own},
+	}
+
+	c, err := cfg.Collector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cameras := c.Cameras.Cameras()
+	if cameras[0].Auth == nil || cameras[0].Auth.Scheme != collector.AuthDigest {
+		t.Errorf("expected gate_a to use the default digest auth, got %+v", cameras[0].Auth)
+	}
+	if cameras[1].Auth != own {
+		t.Errorf("expected gate_b to keep its own auth, got %+v", cameras[1].Auth)
+	}
+	if cfg.Cameras[0].Auth != nil {
+		t.Error("expected the configured cameras not to be modified")
+	}
+}
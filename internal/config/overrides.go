@@ -0,0 +1,240 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/collector"
+	"github.com/akhilesharora/turnaround-collector/internal/spool"
+)
+
+// setting is a single value that can be overridden by an environment
+// variable and a command-line flag.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"CAMERA_COUNT", "camera-count", "number of default cameras", intValue(func(c *Config) *int { return &c.CameraCount })},
+	{"CAMERA_BASE_URL", "camera-base-url", "base URL of the default cameras", stringValue(func(c *Config) *string { return &c.CameraBaseURL })},
+	{"CAMERAS_FILE", "cameras-file", "JSON camera registry file", setCamerasFile},
+	{"CAMERAS", "cameras", "inline JSON camera registry", setCameras},
+	{"CAMERA_AUTH_SCHEME", "camera-auth-scheme", "basic, digest or bearer auth for cameras without their own", setCameraAuthScheme},
+	{"CAMERA_AUTH_USERNAME", "camera-auth-username", "camera auth username", stringValue(func(c *Config) *string { return &c.CameraAuth.Username })},
+	{"CAMERA_AUTH_SECRET_FILE", "camera-auth-secret-file", "file holding the camera password or token", stringValue(func(c *Config) *string { return &c.CameraAuth.SecretFile })},
+	{"CAMERA_AUTH_SECRET_ENV", "camera-auth-secret-env", "environment variable holding the camera password or token", stringValue(func(c *Config) *string { return &c.CameraAuth.SecretEnv })},
+	{"POLL_INTERVAL", "poll-interval", "interval between polls of each camera", durationValue(func(c *Config) *collector.Duration { return &c.PollInterval })},
+	{"MAX_CONCURRENT", "max-concurrent", "maximum concurrent frames (0 = one per camera)", intValue(func(c *Config) *int { return &c.MaxConcurrent })},
+	{"ALIGN_POLLS", "align-polls", "poll on wall-clock multiples of the interval and tag frame sets", boolValue(func(c *Config) *bool { return &c.AlignPolls })},
+	{"DUPLICATE_FRAMES", "duplicate-frames", "send, mark or skip frames identical to the last one delivered", setDuplicateFrames},
+	{"FROZEN_AFTER", "frozen-after", "identical frames in a row that report a camera frozen (0 = never)", intValue(func(c *Config) *int { return &c.FrozenAfter })},
+	{"ADAPTIVE_POLLING", "adaptive-polling", "vary poll intervals with scene changes and skip unchanged frames", boolValue(func(c *Config) *bool { return &c.Adaptive.Enabled })},
+	{"ADAPTIVE_MIN_INTERVAL", "adaptive-min-interval", "fastest adaptive poll interval", durationValue(func(c *Config) *collector.Duration { return &c.Adaptive.MinInterval })},
+	{"ADAPTIVE_MAX_INTERVAL", "adaptive-max-interval", "slowest adaptive poll interval", durationValue(func(c *Config) *collector.Duration { return &c.Adaptive.MaxInterval })},
+	{"ADAPTIVE_CHANGE_THRESHOLD", "adaptive-change-threshold", "fraction of differing hash bits that counts as a scene change", floatValue(func(c *Config) *float64 { return &c.Adaptive.ChangeThreshold })},
+	{"TARGET_URL", "target-url", "URL images are posted to", stringValue(func(c *Config) *string { return &c.TargetURL })},
+	{"TARGETS", "targets", "inline JSON array of fan-out targets", setTargets},
+	{"REQUEST_TIMEOUT", "request-timeout", "default HTTP request timeout", durationValue(func(c *Config) *collector.Duration { return &c.RequestTimeout })},
+	{"MAX_IMAGE_BYTES", "max-image-bytes", "largest camera response read, in bytes (0 = unlimited)", int64Value(func(c *Config) *int64 { return &c.MaxImageBytes })},
+	{"STREAM_IMAGES", "stream-images", "pipe camera responses into target requests without buffering", boolValue(func(c *Config) *bool { return &c.Stream })},
+	{"VALIDATE_IMAGES", "validate-images", "reject camera responses that are not acceptable JPEGs", boolValue(func(c *Config) *bool { return &c.ImageValidation.Enabled })},
+	{"IMAGE_MIN_BYTES", "image-min-bytes", "smallest accepted frame in bytes (0 = unchecked)", int64Value(func(c *Config) *int64 { return &c.ImageValidation.MinBytes })},
+	{"IMAGE_MIN_WIDTH", "image-min-width", "narrowest accepted frame in pixels", intValue(func(c *Config) *int { return &c.ImageValidation.MinWidth })},
+	{"IMAGE_MIN_HEIGHT", "image-min-height", "shortest accepted frame in pixels", intValue(func(c *Config) *int { return &c.ImageValidation.MinHeight })},
+	{"IMAGE_MAX_WIDTH", "image-max-width", "widest accepted frame in pixels (0 = unchecked)", intValue(func(c *Config) *int { return &c.ImageValidation.MaxWidth })},
+	{"IMAGE_MAX_HEIGHT", "image-max-height", "tallest accepted frame in pixels (0 = unchecked)", intValue(func(c *Config) *int { return &c.ImageValidation.MaxHeight })},
+	{"RETRY_MAX_ATTEMPTS", "retry-max-attempts", "attempts per request including the first", intValue(func(c *Config) *int { return &c.Retry.MaxAttempts })},
+	{"RETRY_BASE_DELAY", "retry-base-delay", "delay before the first retry", durationValue(func(c *Config) *collector.Duration { return &c.Retry.BaseDelay })},
+	{"RETRY_MAX_DELAY", "retry-max-delay", "upper bound for retry delays", durationValue(func(c *Config) *collector.Duration { return &c.Retry.MaxDelay })},
+	{"BREAKER_FAILURE_THRESHOLD", "breaker-failure-threshold", "consecutive failures that open a circuit", intValue(func(c *Config) *int { return &c.Breaker.FailureThreshold })},
+	{"BREAKER_COOLDOWN", "breaker-cooldown", "time an open circuit waits before probing", durationValue(func(c *Config) *collector.Duration { return &c.Breaker.Cooldown })},
+	{"SPOOL_DIR", "spool-dir", "spool directory (empty disables spooling)", stringValue(func(c *Config) *string { return &c.Spool.Dir })},
+	{"SPOOL_MAX_BYTES", "spool-max-bytes", "spool size limit in bytes (0 = unlimited)", int64Value(func(c *Config) *int64 { return &c.Spool.MaxBytes })},
+	{"SPOOL_MAX_AGE", "spool-max-age", "age after which spooled frames expire (0 = never)", durationValue(func(c *Config) *collector.Duration { return &c.Spool.MaxAge })},
+	{"SPOOL_EVICTION", "spool-eviction", "eviction policy when the spool is full", setSpoolEviction},
+	{"TLS_CA_FILE", "tls-ca-file", "additional trusted CA bundle", stringValue(func(c *Config) *string { return &c.TLS.CAFile })},
+	{"TLS_CERT_FILE", "tls-cert-file", "client certificate", stringValue(func(c *Config) *string { return &c.TLS.CertFile })},
+	{"TLS_KEY_FILE", "tls-key-file", "client certificate key", stringValue(func(c *Config) *string { return &c.TLS.KeyFile })},
+	{"TLS_INSECURE_SKIP_VERIFY", "tls-insecure-skip-verify", "skip server certificate verification", boolValue(func(c *Config) *bool { return &c.TLS.InsecureSkipVerify })},
+	{"TARGET_KEY_ID", "target-key-id", "API key id deliveries are signed with (empty sends them unsigned)", stringValue(func(c *Config) *string { return &c.TargetAuth.KeyID })},
+	{"TARGET_KEY_SECRET_FILE", "target-key-secret-file", "file holding the API key secret", stringValue(func(c *Config) *string { return &c.TargetAuth.SecretFile })},
+	{"TARGET_KEY_SECRET_ENV", "target-key-secret-env", "environment variable holding the API key secret", stringValue(func(c *Config) *string { return &c.TargetAuth.SecretEnv })},
+	{"ADMIN_ADDR", "admin-addr", "admin server address (empty disables it)", stringValue(func(c *Config) *string { return &c.Admin.Addr })},
+	{"ADMIN_TOKEN", "admin-token", "bearer token for the camera management API (empty disables it)", stringValue(func(c *Config) *string { return &c.Admin.Token })},
+	{"READY_SUCCESS_THRESHOLD", "ready-success-threshold", "minimum recent success rate to report ready", floatValue(func(c *Config) *float64 { return &c.Admin.ReadySuccessThreshold })},
+	{"READY_MIN_SAMPLES", "ready-min-samples", "frames needed before the success rate is enforced", intValue(func(c *Config) *int { return &c.Admin.ReadyMinSamples })},
+	{"LOG_LEVEL", "log-level", "debug, info, warn or error", stringValue(func(c *Config) *string { return &c.Log.Level })},
+	{"LOG_FORMAT", "log-format", "text or json", stringValue(func(c *Config) *string { return &c.Log.Format })},
+}
+
+// ApplyEnv overrides c with the environment variables reported by lookup.
+// Unlike the defaults, a malformed value is an error rather than ignored.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, s := range settings {
+		value, ok := lookup(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(c, value); err != nil {
+			return fmt.Errorf("%s: %w", s.env, err)
+		}
+	}
+	return nil
+}
+
+// Flags collects overrides given on the command line.
+type Flags struct {
+	values []flagValue
+}
+
+type flagValue struct {
+	setting setting
+	value   string
+}
+
+// RegisterFlags defines a flag for every overridable setting on fs.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{}
+	for _, s := range settings {
+		fs.Func(s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env), func(value string) error {
+			f.values = append(f.values, flagValue{setting: s, value: value})
+			return nil
+		})
+	}
+	return f
+}
+
+// Apply overrides c with the flags that were set, in command-line order.
+func (f *Flags) Apply(c *Config) error {
+	for _, v := range f.values {
+		if err := v.setting.set(c, v.value); err != nil {
+			return fmt.Errorf("-%s: %w", v.setting.flag, err)
+		}
+	}
+	return nil
+}
+
+func stringValue(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func intValue(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func int64Value(field func(*Config) *int64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func floatValue(field func(*Config) *float64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+func boolValue(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func durationValue(field func(*Config) *collector.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*field(c) = collector.Duration(d)
+		return nil
+	}
+}
+
+func setSpoolEviction(c *Config, value string) error {
+	policy, err := spool.ParseEvictionPolicy(value)
+	if err != nil {
+		return err
+	}
+	c.Spool.Eviction = policy
+	return nil
+}
+
+func setDuplicateFrames(c *Config, value string) error {
+	policy, err := collector.ParseDuplicatePolicy(value)
+	if err != nil {
+		return err
+	}
+	c.DuplicateFrames = policy
+	return nil
+}
+
+func setCameraAuthScheme(c *Config, value string) error {
+	scheme, err := collector.ParseAuthScheme(value)
+	if err != nil {
+		return err
+	}
+	c.CameraAuth.Scheme = scheme
+	return nil
+}
+
+func setCamerasFile(c *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return setCameras(c, string(data))
+}
+
+func setCameras(c *Config, inline string) error {
+	registry, err := collector.ParseRegistry([]byte(inline))
+	if err != nil {
+		return err
+	}
+	c.Cameras = registry.Cameras()
+	return nil
+}
+
+func setTargets(c *Config, inline string) error {
+	dec := json.NewDecoder(strings.NewReader(inline))
+	dec.DisallowUnknownFields()
+	var targets []TargetConfig
+	if err := dec.Decode(&targets); err != nil {
+		return fmt.Errorf("parse targets: %w", err)
+	}
+	c.Targets = targets
+	return nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"time"
+)
+
+// RestartRequired lists the settings that differ between c and next but
+// only take effect after a restart.
+func (c Config) RestartRequired(next Config) []string {
+	var changed []string
+	for _, s := range []struct {
+		name      string
+		old, next any
+	}{
+		{"targets", c.Targets, next.Targets},
+		{"request_timeout", c.RequestTimeout, next.RequestTimeout},
+		{"max_image_bytes", c.MaxImageBytes, next.MaxImageBytes},
+		{"stream", c.Stream, next.Stream},
+		{"image_validation", c.ImageValidation, next.ImageValidation},
+		{"retry", c.Retry, next.Retry},
+		{"breaker", c.Breaker, next.Breaker},
+		{"spool", c.Spool, next.Spool},
+		{"tls", c.TLS, next.TLS},
+		{"target_auth", c.TargetAuth, next.TargetAuth},
+		{"admin", c.Admin, next.Admin},
+		{"log", c.Log, next.Log},
+	} {
+		if !reflect.DeepEqual(s.old, s.next) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
+
+// Watch calls onChange whenever the modification time or size of path
+// changes, checking every interval until ctx is done.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	last, _ := os.Stat(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			// Editors often replace files; wait for the new one to appear
+			continue
+		}
+		if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+			last = info
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package duration
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDurationJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    Duration
+		expectedErr bool
+	}{
+		{name: "seconds", input: `"5s"`, expected: Duration(5 * time.Second)},
+		{name: "mixed units", input: `"1h30m"`, expected: Duration(90 * time.Minute)},
+		{name: "number", input: `5`, expectedErr: true},
+		{name: "no unit", input: `"5"`, expectedErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Duration
+			err := json.Unmarshal([]byte(tt.input), &d)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error=%v, got %v", tt.expectedErr, err)
+			}
+			if err == nil && d != tt.expected {
+				t.Errorf("expected %v, got %v", time.Duration(tt.expected), time.Duration(d))
+			}
+		})
+	}
+
+	data, _ := json.Marshal(Duration(1500 * time.Millisecond))
+	if string(data) != `"1.5s"` {
+		t.Errorf("expected \"1.5s\", got %s", data)
+	}
+}
@@ -0,0 +1,119 @@
+// Package health provides /healthz and /readyz handlers shared by all services.
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Check returns nil when the component it guards is ready.
+type Check func() error
+
+type Checker struct {
+	mu     sync.RWMutex
+	names  []string
+	checks map[string]Check
+}
+
+func NewChecker() *Checker {
+	return &Checker{checks: make(map[string]Check)}
+}
+
+// AddReadinessCheck registers a check that must pass for /readyz to succeed.
+func (c *Checker) AddReadinessCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.checks[name]; !exists {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Ready runs every readiness check and joins the failures.
+func (c *Checker) Ready() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var errs []error
+	for _, name := range c.names {
+		if err := c.checks[name](); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Register mounts /healthz and /readyz on mux.
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", c.serveLiveness)
+	mux.HandleFunc("/readyz", c.serveReadiness)
+}
+
+// serveLiveness only reports that the process is up and serving HTTP.
+func (c *Checker) serveLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+func (c *Checker) serveReadiness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := c.Ready(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "not ready:\n%v\n", err)
+		return
+	}
+	w.Write([]byte("ready\n"))
+}
+
+// SuccessRate tracks the outcome of the most recent operations in a ring buffer.
+type SuccessRate struct {
+	mu       sync.Mutex
+	outcomes []bool
+	next     int
+	filled   int
+}
+
+func NewSuccessRate(window int) *SuccessRate {
+	return &SuccessRate{outcomes: make([]bool, max(window, 1))}
+}
+
+func (s *SuccessRate) Record(ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outcomes[s.next] = ok
+	s.next = (s.next + 1) % len(s.outcomes)
+	s.filled = min(s.filled+1, len(s.outcomes))
+}
+
+// Rate returns the success ratio and the number of samples it is based on.
+func (s *SuccessRate) Rate() (float64, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.filled == 0 {
+		return 1, 0
+	}
+	successes := 0
+	for _, ok := range s.outcomes[:s.filled] {
+		if ok {
+			successes++
+		}
+	}
+	return float64(successes) / float64(s.filled), s.filled
+}
+
+// Check fails once at least minSamples outcomes are recorded and the
+// success ratio has dropped below threshold.
+func (s *SuccessRate) Check(threshold float64, minSamples int) Check {
+	return func() error {
+		rate, samples := s.Rate()
+		if samples >= minSamples && rate < threshold {
+			return fmt.Errorf("success rate %.2f over last %d operations is below %.2f", rate, samples, threshold)
+		}
+		return nil
+	}
+}
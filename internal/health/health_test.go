@@ -0,0 +1,93 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChecker(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		checks         map[string]Check
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "liveness ignores readiness checks",
+			path:           "/healthz",
+			checks:         map[string]Check{"target": func() error { return errors.New("unreachable") }},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ok",
+		},
+		{
+			name:           "ready",
+			path:           "/readyz",
+			checks:         map[string]Check{"target": func() error { return nil }},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ready",
+		},
+		{
+			name:           "not ready",
+			path:           "/readyz",
+			checks:         map[string]Check{"target": func() error { return errors.New("unreachable") }},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "target: unreachable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker()
+			for name, check := range tt.checks {
+				checker.AddReadinessCheck(name, check)
+			}
+			mux := http.NewServeMux()
+			checker.Register(mux)
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSuccessRate(t *testing.T) {
+	rate := NewSuccessRate(4)
+	check := rate.Check(0.5, 3)
+
+	if err := check(); err != nil {
+		t.Fatalf("expected no samples to be healthy, got %v", err)
+	}
+
+	rate.Record(false)
+	rate.Record(false)
+	if err := check(); err != nil {
+		t.Fatalf("expected too few samples to be healthy, got %v", err)
+	}
+
+	rate.Record(true)
+	if err := check(); err == nil {
+		t.Fatal("expected 1/3 success rate to fail the check")
+	}
+
+	// The two failures fall out of the window
+	for i := 0; i < 3; i++ {
+		rate.Record(true)
+	}
+	if r, n := rate.Rate(); r != 1 || n != 4 {
+		t.Fatalf("expected rate 1 over 4 samples, got %v over %d", r, n)
+	}
+	if err := check(); err != nil {
+		t.Fatalf("expected recovered rate to pass, got %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+// Package httpauth implements HTTP Digest authentication (RFC 7616) for
+// both sides: the collector answering camera challenges and the simulated
+// camera issuing and checking them.
+package httpauth
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Digest algorithms, strongest first.
+const (
+	SHA256     = "SHA-256"
+	SHA256Sess = "SHA-256-sess"
+	MD5        = "MD5"
+	MD5Sess    = "MD5-sess"
+)
+
+var algorithms = []string{SHA256, SHA256Sess, MD5, MD5Sess}
+
+func hasher(algorithm string) func() hash.Hash {
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	}
+	return nil
+}
+
+// Challenge is a Digest WWW-Authenticate challenge.
+type Challenge struct {
+	Realm     string
+	Nonce     string
+	Opaque    string
+	Algorithm string
+	QOP       []string
+	Stale     bool
+}
+
+// String formats the challenge as a WWW-Authenticate value.
+func (c Challenge) String() string {
+	s := fmt.Sprintf(`Digest realm=%q, nonce=%q, algorithm=%s`, c.Realm, c.Nonce, c.Algorithm)
+	if len(c.QOP) > 0 {
+		s += fmt.Sprintf(`, qop=%q`, strings.Join(c.QOP, ", "))
+	}
+	if c.Opaque != "" {
+		s += fmt.Sprintf(`, opaque=%q`, c.Opaque)
+	}
+	if c.Stale {
+		s += ", stale=true"
+	}
+	return s
+}
+
+// supported reports whether the collector can answer the challenge. Only
+// qop=auth is implemented; auth-int would need the request body.
+func (c Challenge) supported() bool {
+	if c.Nonce == "" || hasher(c.Algorithm) == nil {
+		return false
+	}
+	return len(c.QOP) == 0 || c.qop() != ""
+}
+
+func (c Challenge) qop() string {
+	for _, q := range c.QOP {
+		if q == "auth" {
+			return q
+		}
+	}
+	return ""
+}
+
+// ParseChallenge picks the strongest supported Digest challenge among the
+// WWW-Authenticate values of a 401 response.
+func ParseChallenge(values []string) (Challenge, bool) {
+	var best Challenge
+	bestRank := len(algorithms)
+	for _, v := range values {
+		scheme, rest, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		params := ParseParams(rest)
+		c := Challenge{
+			Realm:     params["realm"],
+			Nonce:     params["nonce"],
+			Opaque:    params["opaque"],
+			Algorithm: params["algorithm"],
+			Stale:     strings.EqualFold(params["stale"], "true"),
+		}
+		if c.Algorithm == "" {
+			c.Algorithm = MD5
+		}
+		for _, q := range strings.Split(params["qop"], ",") {
+			if q = strings.TrimSpace(q); q != "" {
+				c.QOP = append(c.QOP, q)
+			}
+		}
+		if !c.supported() {
+			continue
+		}
+		rank := len(algorithms) - 1
+		for i, a := range algorithms {
+			if strings.EqualFold(a, c.Algorithm) {
+				rank = i
+			}
+		}
+		if rank < bestRank || best.Nonce == "" {
+			best, bestRank = c, rank
+		}
+	}
+	return best, best.Nonce != ""
+}
+
+// ParseParams splits a comma-separated list of key=value pairs, where values
+// may be quoted strings. Keys are lowercased.
+func ParseParams(s string) map[string]string {
+	params := make(map[string]string)
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(strings.TrimLeft(key, ", ")))
+		rest = strings.TrimSpace(rest)
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			value, s = b.String(), rest[min(i+1, len(rest)):]
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		params[key] = value
+		s = strings.TrimPrefix(strings.TrimSpace(s), ",")
+	}
+	return params
+}
+
+// Credentials are the parameters of a Digest Authorization header.
+type Credentials struct {
+	Username  string
+	Realm     string
+	Nonce     string
+	URI       string
+	Algorithm string
+	QOP       string
+	NC        string
+	CNonce    string
+	Opaque    string
+	Response  string
+}
+
+// ParseCredentials reads a Digest Authorization header value.
+func ParseCredentials(header string) (Credentials, bool) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return Credentials{}, false
+	}
+	p := ParseParams(rest)
+	return Credentials{
+		Username:  p["username"],
+		Realm:     p["realm"],
+		Nonce:     p["nonce"],
+		URI:       p["uri"],
+		Algorithm: p["algorithm"],
+		QOP:       p["qop"],
+		NC:        p["nc"],
+		CNonce:    p["cnonce"],
+		Opaque:    p["opaque"],
+		Response:  p["response"],
+	}, true
+}
+
+// String formats the credentials as an Authorization value.
+func (c Credentials) String() string {
+	s := fmt.Sprintf(`Digest username=%q, realm=%q, nonce=%q, uri=%q, algorithm=%s, response=%q`,
+		c.Username, c.Realm, c.Nonce, c.URI, c.Algorithm, c.Response)
+	if c.QOP != "" {
+		s += fmt.Sprintf(`, qop=%s, nc=%s, cnonce=%q`, c.QOP, c.NC, c.CNonce)
+	}
+	if c.Opaque != "" {
+		s += fmt.Sprintf(`, opaque=%q`, c.Opaque)
+	}
+	return s
+}
+
+// Sign answers challenge for a request, returning the credentials to send.
+// nc counts the requests made with the challenge's nonce, starting at 1.
+func Sign(challenge Challenge, username, password, method, uri, cnonce string, nc uint32) Credentials {
+	c := Credentials{
+		Username:  username,
+		Realm:     challenge.Realm,
+		Nonce:     challenge.Nonce,
+		URI:       uri,
+		Algorithm: challenge.Algorithm,
+		Opaque:    challenge.Opaque,
+	}
+	if qop := challenge.qop(); qop != "" {
+		c.QOP, c.NC, c.CNonce = qop, fmt.Sprintf("%08x", nc), cnonce
+	}
+	c.Response = c.Expected(password, method)
+	return c
+}
+
+// Expected computes the response a client knowing password sends for the
+// credentials, as a server does to check them.
+func (c Credentials) Expected(password, method string) string {
+	newHash := hasher(c.Algorithm)
+	if newHash == nil {
+		return ""
+	}
+	h := func(parts ...string) string {
+		hh := newHash()
+		hh.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	ha1 := h(c.Username, c.Realm, password)
+	if strings.HasSuffix(strings.ToLower(c.Algorithm), "-sess") {
+		ha1 = h(ha1, c.Nonce, c.CNonce)
+	}
+	ha2 := h(method, c.URI)
+	if c.QOP == "" {
+		return h(ha1, c.Nonce, ha2)
+	}
+	return h(ha1, c.Nonce, c.NC, c.CNonce, c.QOP, ha2)
+}
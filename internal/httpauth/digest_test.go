@@ -0,0 +1,109 @@
+package httpauth
+
+import (
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	// Examples from RFC 7616 section 3.9.1
+	challenge := Challenge{
+		Realm:  "http-auth@example.org",
+		Nonce:  "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+		Opaque: "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+		QOP:    []string{"auth", "auth-int"},
+	}
+	cnonce := "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+
+	tests := []struct {
+		algorithm string
+		expected  string
+	}{
+		{algorithm: MD5, expected: "8ca523f5e9506fed4657c9700eebdbec"},
+		{algorithm: SHA256, expected: "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			challenge.Algorithm = tt.algorithm
+			creds := Sign(challenge, "Mufasa", "Circle of Life", "GET", "/dir/index.html", cnonce, 1)
+			if creds.Response != tt.expected {
+				t.Errorf("expected response %s, got %s", tt.expected, creds.Response)
+			}
+			if creds.QOP != "auth" || creds.NC != "00000001" {
+				t.Errorf("expected qop auth with nc 00000001, got %s %s", creds.QOP, creds.NC)
+			}
+
+			// The server side reads the header back and agrees
+			parsed, ok := ParseCredentials(creds.String())
+			if !ok || parsed != creds {
+				t.Fatalf("expected %+v to round-trip, got %+v", creds, parsed)
+			}
+			if got := parsed.Expected("Circle of Life", "GET"); got != tt.expected {
+				t.Errorf("expected the server to compute %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    []string
+		expectOK  bool
+		algorithm string
+		stale     bool
+	}{
+		{
+			name: "strongest algorithm wins",
+			values: []string{
+				`Digest realm="cam", nonce="n1", algorithm=MD5, qop="auth"`,
+				`Digest realm="cam", nonce="n2", algorithm=SHA-256, qop="auth"`,
+			},
+			expectOK:  true,
+			algorithm: SHA256,
+		},
+		{
+			name:      "legacy challenge without qop",
+			values:    []string{`Digest realm="cam", nonce="n1"`},
+			expectOK:  true,
+			algorithm: MD5,
+		},
+		{
+			name:      "stale nonce",
+			values:    []string{`Basic realm="cam"`, `Digest realm="cam", nonce="n3", qop="auth,auth-int", stale=TRUE`},
+			expectOK:  true,
+			algorithm: MD5,
+			stale:     true,
+		},
+		{name: "only auth-int", values: []string{`Digest realm="cam", nonce="n1", qop="auth-int"`}},
+		{name: "unknown algorithm", values: []string{`Digest realm="cam", nonce="n1", algorithm=SHA-512-256`}},
+		{name: "basic only", values: []string{`Basic realm="cam"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := ParseChallenge(tt.values)
+			if ok != tt.expectOK {
+				t.Fatalf("expected ok %v, got %v (%+v)", tt.expectOK, ok, c)
+			}
+			if ok && (c.Algorithm != tt.algorithm || c.Stale != tt.stale) {
+				t.Errorf("expected %s stale=%v, got %+v", tt.algorithm, tt.stale, c)
+			}
+		})
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	params := ParseParams(`realm="a \"quoted\", realm", nonce=abc, qop="auth, auth-int",stale=false`)
+	expected := map[string]string{
+		"realm": `a "quoted", realm`,
+		"nonce": "abc",
+		"qop":   "auth, auth-int",
+		"stale": "false",
+	}
+	for k, v := range expected {
+		if params[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, params[k])
+		}
+	}
+}
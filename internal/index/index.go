@@ -0,0 +1,488 @@
+// Package index keeps a searchable record of the images the target stored.
+//
+// Entries are appended as JSON lines to a log file, fsynced, and replayed
+// into memory on Open. Deletions are appended too; once superseded lines
+// outnumber live ones the log is rewritten with only the live entries.
+//
+// Every entry is held in memory, at roughly 350 bytes each, so the index
+// suits archives of a few million images, which retention keeps bounded.
+// Each camera's entries are kept sorted on their own: appending the newest
+// frame of a camera and deleting its oldest are cheap, while entries added
+// or deleted out of order cost a copy of the camera's later entries.
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("image not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrClosed        = errors.New("index closed")
+)
+
+// compactMin is the number of superseded lines below which the log is
+// never rewritten.
+const compactMin = 1024
+
+// Entry describes a stored image.
+type Entry struct {
+	ID         string    `json:"id"`
+	CameraID   string    `json:"camera_id"`
+	CapturedAt time.Time `json:"captured_at"`
+	ReceivedAt time.Time `json:"received_at"`
+	Sequence   uint64    `json:"sequence"`
+	Size       int64     `json:"size"`
+	Hash       string    `json:"hash,omitempty"`
+	// Key locates the image in its ImageStore.
+	Key string `json:"key"`
+}
+
+// ID derives the entry ID of the image stored under key, so storing the
+// same image again replaces its entry.
+func ID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:12])
+}
+
+// Query selects entries by camera and capture time, oldest first.
+type Query struct {
+	// CameraID restricts the results to one camera; empty means all.
+	CameraID string
+	// From and To bound the capture time, From inclusive and To exclusive;
+	// zero means unbounded.
+	From, To time.Time
+	// Limit caps the entries returned; 0 means unlimited.
+	Limit int
+	// Cursor continues from the page that returned it.
+	Cursor string
+}
+
+type Page struct {
+	Entries []Entry `json:"images"`
+	// NextCursor is set when more entries match.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// record is one line of the log: an entry, or the deletion of one.
+type record struct {
+	Entry
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// logFile is the open log, an *os.File outside of tests.
+type logFile interface {
+	io.WriteSeeker
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+type Index struct {
+	path string
+
+	mu       sync.RWMutex
+	file     logFile
+	end      int64 // end of the last complete line
+	torn     bool  // a failed write may have left a partial line after end
+	byID     map[string]*Entry
+	byCamera map[string][]*Entry // by capture time, then ID
+	size     int64
+	dead     int // log lines no longer describing a live entry
+}
+
+// Open loads the index at path, creating it if needed. A line torn by a
+// crash at the end of the log is dropped.
+func Open(path string) (*Index, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create index dir: %w", err)
+	}
+	x := &Index{path: path, byID: make(map[string]*Entry), byCamera: make(map[string][]*Entry)}
+	if err := x.load(); err != nil {
+		return nil, err
+	}
+	if err := x.maybeCompact(); err != nil {
+		x.file.Close()
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *Index) load() error {
+	f, err := os.OpenFile(x.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open index: %w", err)
+	}
+
+	var good int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("read index: %w", err)
+		}
+		var rec record
+		if json.Unmarshal(line, &rec) != nil || rec.ID == "" {
+			break
+		}
+		good += int64(len(line))
+		x.apply(rec)
+	}
+	if err := f.Truncate(good); err != nil {
+		f.Close()
+		return fmt.Errorf("truncate index: %w", err)
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return fmt.Errorf("open index: %w", err)
+	}
+	x.file = f
+	x.end = good
+	return nil
+}
+
+// apply updates the in-memory state with a record.
+func (x *Index) apply(rec record) {
+	if old, exists := x.byID[rec.ID]; exists {
+		x.dead++
+		x.size -= old.Size
+		x.remove(old)
+	}
+	if rec.Deleted {
+		x.dead++
+		delete(x.byID, rec.ID)
+		return
+	}
+	e := rec.Entry
+	e.CapturedAt = e.CapturedAt.UTC()
+	e.ReceivedAt = e.ReceivedAt.UTC()
+	x.byID[e.ID] = &e
+	x.size += e.Size
+	entries := x.byCamera[e.CameraID]
+	i, _ := slices.BinarySearchFunc(entries, &e, compare)
+	x.byCamera[e.CameraID] = slices.Insert(entries, i, &e)
+}
+
+func (x *Index) remove(e *Entry) {
+	entries := x.byCamera[e.CameraID]
+	i, _ := slices.BinarySearchFunc(entries, e, compare)
+	switch {
+	case len(entries) == 1:
+		delete(x.byCamera, e.CameraID)
+		return
+	case i == 0:
+		// Retention deletes the oldest frames; reslicing avoids moving the rest
+		entries[0] = nil
+		entries = entries[1:]
+	default:
+		entries = slices.Delete(entries, i, i+1)
+	}
+	x.byCamera[e.CameraID] = entries
+}
+
+func compare(a, b *Entry) int {
+	if c := a.CapturedAt.Compare(b.CapturedAt); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+// Add records e, replacing any entry with the same ID.
+func (x *Index) Add(e Entry) error {
+	if e.ID == "" {
+		return errors.New("entry without id")
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := x.append(record{Entry: e}); err != nil {
+		return err
+	}
+	return x.maybeCompact()
+}
+
+// Delete removes the entries with the given IDs; unknown IDs are ignored.
+func (x *Index) Delete(ids ...string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var records []record
+	for _, id := range ids {
+		if _, ok := x.byID[id]; ok {
+			records = append(records, record{Entry: Entry{ID: id}, Deleted: true})
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	if err := x.append(records...); err != nil {
+		return err
+	}
+	return x.maybeCompact()
+}
+
+func (x *Index) append(records ...record) error {
+	if x.file == nil {
+		return ErrClosed
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return fmt.Errorf("encode index entry: %w", err)
+		}
+	}
+	// Load stops at the first broken line, so nothing may follow one
+	if x.torn {
+		if err := x.truncate(); err != nil {
+			return err
+		}
+	}
+	if _, err := x.file.Write(buf.Bytes()); err != nil {
+		return x.fail(fmt.Errorf("write index: %w", err))
+	}
+	if err := x.file.Sync(); err != nil {
+		return x.fail(fmt.Errorf("sync index: %w", err))
+	}
+	x.end += int64(buf.Len())
+	for _, rec := range records {
+		x.apply(rec)
+	}
+	return nil
+}
+
+// fail cuts what a failed write left behind off the log. Until that
+// succeeds, appends retry it first.
+func (x *Index) fail(err error) error {
+	x.torn = true
+	return errors.Join(err, x.truncate())
+}
+
+func (x *Index) truncate() error {
+	if err := x.file.Truncate(x.end); err != nil {
+		return fmt.Errorf("truncate index: %w", err)
+	}
+	if _, err := x.file.Seek(x.end, io.SeekStart); err != nil {
+		return fmt.Errorf("truncate index: %w", err)
+	}
+	x.torn = false
+	return nil
+}
+
+func (x *Index) maybeCompact() error {
+	if x.dead < compactMin || x.dead < len(x.byID) {
+		return nil
+	}
+	return x.compact()
+}
+
+// compact rewrites the log with the live entries, through a temporary file
+// renamed over it.
+func (x *Index) compact() error {
+	tmp := x.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("compact index: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, entries := range x.byCamera {
+		for _, e := range entries {
+			if err := enc.Encode(record{Entry: *e}); err != nil {
+				f.Close()
+				return fmt.Errorf("compact index: %w", err)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("compact index: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync index: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("compact index: %w", err)
+	}
+	if err := os.Rename(tmp, x.path); err != nil {
+		return fmt.Errorf("compact index: %w", err)
+	}
+
+	// The old file is gone; appending to it would lose entries
+	x.file.Close()
+	file, err := os.OpenFile(x.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		x.file = nil
+		return fmt.Errorf("open index: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		x.file = nil
+		return fmt.Errorf("open index: %w", err)
+	}
+	x.file, x.end, x.torn = file, info.Size(), false
+	x.dead = 0
+	return syncDir(filepath.Dir(x.path))
+}
+
+func (x *Index) Get(id string) (Entry, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	e, ok := x.byID[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return *e, nil
+}
+
+// Query returns the entries matching q, oldest first.
+func (x *Index) Query(q Query) (Page, error) {
+	var after *Entry
+	if q.Cursor != "" {
+		e, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		after = &e
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	// The cameras' sorted entries are merged from their first match on
+	var heads [][]*Entry
+	add := func(entries []*Entry) {
+		if entries = entries[start(entries, q.From, after):]; len(entries) > 0 {
+			heads = append(heads, entries)
+		}
+	}
+	if q.CameraID != "" {
+		add(x.byCamera[q.CameraID])
+	} else {
+		for _, entries := range x.byCamera {
+			add(entries)
+		}
+	}
+
+	page := Page{Entries: []Entry{}}
+	for len(heads) > 0 {
+		next := 0
+		for i := 1; i < len(heads); i++ {
+			if compare(heads[i][0], heads[next][0]) < 0 {
+				next = i
+			}
+		}
+		e := heads[next][0]
+		if !q.To.IsZero() && !e.CapturedAt.Before(q.To) {
+			break
+		}
+		if q.Limit > 0 && len(page.Entries) == q.Limit {
+			page.NextCursor = encodeCursor(page.Entries[len(page.Entries)-1])
+			break
+		}
+		page.Entries = append(page.Entries, *e)
+		if heads[next] = heads[next][1:]; len(heads[next]) == 0 {
+			heads = slices.Delete(heads, next, next+1)
+		}
+	}
+	return page, nil
+}
+
+// start returns the position of the first of entries captured at or after
+// from and following after, either of which may be unset.
+func start(entries []*Entry, from time.Time, after *Entry) int {
+	var i int
+	if !from.IsZero() {
+		i, _ = slices.BinarySearchFunc(entries, from, func(e *Entry, t time.Time) int {
+			if e.CapturedAt.Before(t) {
+				return -1
+			}
+			return 1
+		})
+	}
+	if after != nil {
+		j, found := slices.BinarySearchFunc(entries, after, compare)
+		if found {
+			j++
+		}
+		i = max(i, j)
+	}
+	return i
+}
+
+// Len returns the number of entries.
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.byID)
+}
+
+// Size returns the total size of the indexed images in bytes.
+func (x *Index) Size() int64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.size
+}
+
+func (x *Index) Close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.file == nil {
+		return nil
+	}
+	err := x.file.Close()
+	x.file = nil
+	return err
+}
+
+func encodeCursor(e Entry) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(e.CapturedAt.UnixNano(), 10) + "/" + e.ID))
+}
+
+func decodeCursor(cursor string) (Entry, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Entry{}, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), "/")
+	if !ok || id == "" {
+		return Entry{}, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return Entry{}, ErrInvalidCursor
+	}
+	return Entry{ID: id, CapturedAt: time.Unix(0, n).UTC()}, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open index dir: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync index dir: %w", err)
+	}
+	return nil
+}
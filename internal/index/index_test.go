@@ -0,0 +1,257 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var base = time.Date(2024, 11, 2, 10, 0, 0, 0, time.UTC)
+
+func mustOpen(t *testing.T, path string) *Index {
+	t.Helper()
+	x, err := Open(path)
+	if err != nil {
+		t.Fatalf("open index: %v", err)
+	}
+	return x
+}
+
+func entry(camera string, minute int) Entry {
+	key := fmt.Sprintf("%s/2024-11-02/%d.jpg", camera, minute)
+	return Entry{
+		ID:         ID(key),
+		CameraID:   camera,
+		CapturedAt: base.Add(time.Duration(minute) * time.Minute),
+		ReceivedAt: base.Add(time.Duration(minute)*time.Minute + time.Second),
+		Size:       100,
+		Key:        key,
+	}
+}
+
+func ids(entries []Entry) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Key)
+	}
+	return out
+}
+
+func TestIndexQuery(t *testing.T) {
+	x := mustOpen(t, filepath.Join(t.TempDir(), "images.log"))
+	defer x.Close()
+	// Added out of order, as concurrent deliveries may be
+	for _, e := range []Entry{entry("camera_1", 2), entry("camera_2", 1), entry("camera_1", 0), entry("camera_1", 1), entry("camera_2", 3)} {
+		if err := x.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		query    Query
+		expected [][]string // keys of each page
+	}{
+		{
+			name:     "all",
+			expected: [][]string{{"camera_1/2024-11-02/0.jpg", "camera_1/2024-11-02/1.jpg", "camera_2/2024-11-02/1.jpg", "camera_1/2024-11-02/2.jpg", "camera_2/2024-11-02/3.jpg"}},
+		},
+		{
+			name:     "one camera",
+			query:    Query{CameraID: "camera_2"},
+			expected: [][]string{{"camera_2/2024-11-02/1.jpg", "camera_2/2024-11-02/3.jpg"}},
+		},
+		{
+			name:     "time range",
+			query:    Query{From: base.Add(time.Minute), To: base.Add(3 * time.Minute)},
+			expected: [][]string{{"camera_1/2024-11-02/1.jpg", "camera_2/2024-11-02/1.jpg", "camera_1/2024-11-02/2.jpg"}},
+		},
+		{
+			name:  "pages",
+			query: Query{Limit: 2},
+			expected: [][]string{
+				{"camera_1/2024-11-02/0.jpg", "camera_1/2024-11-02/1.jpg"},
+				{"camera_2/2024-11-02/1.jpg", "camera_1/2024-11-02/2.jpg"},
+				{"camera_2/2024-11-02/3.jpg"},
+			},
+		},
+		{
+			name:  "pages of one camera",
+			query: Query{CameraID: "camera_1", Limit: 2},
+			expected: [][]string{
+				{"camera_1/2024-11-02/0.jpg", "camera_1/2024-11-02/1.jpg"},
+				{"camera_1/2024-11-02/2.jpg"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.query
+			for i, expected := range tt.expected {
+				page, err := x.Query(q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := ids(page.Entries); fmt.Sprint(got) != fmt.Sprint(expected) {
+					t.Errorf("page %d: expected %v, got %v", i, expected, got)
+				}
+				if last := i == len(tt.expected)-1; last != (page.NextCursor == "") {
+					t.Fatalf("page %d: unexpected cursor %q", i, page.NextCursor)
+				}
+				q.Cursor = page.NextCursor
+			}
+		})
+	}
+
+	if _, err := x.Query(Query{Cursor: "not a cursor"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestIndexReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "images.log")
+	x := mustOpen(t, path)
+	for i := 0; i < 3; i++ {
+		if err := x.Add(entry("camera_1", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replaced := entry("camera_1", 1)
+	replaced.Size = 250
+	if err := x.Add(replaced); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Delete(entry("camera_1", 0).ID, "unknown"); err != nil {
+		t.Fatal(err)
+	}
+	x.Close()
+
+	// A torn line from a crash is dropped
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"abc","camera_`)
+	f.Close()
+
+	x = mustOpen(t, path)
+	defer x.Close()
+	if x.Len() != 2 || x.Size() != 350 {
+		t.Errorf("expected 2 entries of 350 bytes, got %d of %d", x.Len(), x.Size())
+	}
+	if _, err := x.Get(entry("camera_1", 0).ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the deleted entry to stay deleted, got %v", err)
+	}
+	got, err := x.Get(replaced.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != replaced {
+		t.Errorf("expected %+v, got %+v", replaced, got)
+	}
+	if err := x.Add(entry("camera_1", 5)); err != nil {
+		t.Fatalf("expected appends after recovery, got %v", err)
+	}
+}
+
+// faultyFile writes half of the next line and fails, as on a full disk.
+type faultyFile struct {
+	logFile
+	failWrite    bool
+	failTruncate bool
+}
+
+func (f *faultyFile) Write(p []byte) (int, error) {
+	if !f.failWrite {
+		return f.logFile.Write(p)
+	}
+	n, _ := f.logFile.Write(p[:len(p)/2])
+	return n, errors.New("no space left on device")
+}
+
+func (f *faultyFile) Truncate(size int64) error {
+	if f.failTruncate {
+		return errors.New("input/output error")
+	}
+	return f.logFile.Truncate(size)
+}
+
+func TestIndexFailedAppend(t *testing.T) {
+	for _, failTruncate := range []bool{false, true} {
+		t.Run(fmt.Sprintf("truncate fails %v", failTruncate), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "images.log")
+			x := mustOpen(t, path)
+			if err := x.Add(entry("camera_1", 0)); err != nil {
+				t.Fatal(err)
+			}
+			faulty := &faultyFile{logFile: x.file, failWrite: true, failTruncate: failTruncate}
+			x.file = faulty
+			if err := x.Add(entry("camera_1", 1)); err == nil {
+				t.Fatal("expected the short write to fail the add")
+			}
+			if _, err := x.Get(entry("camera_1", 1).ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected the failed entry to be left out, got %v", err)
+			}
+			faulty.failWrite = false
+			if failTruncate {
+				// Nothing is appended behind the torn line until it is cut off
+				if err := x.Add(entry("camera_1", 2)); err == nil {
+					t.Fatal("expected the add to fail while the torn line remains")
+				}
+				faulty.failTruncate = false
+			}
+			if err := x.Add(entry("camera_1", 2)); err != nil {
+				t.Fatal(err)
+			}
+			x.Close()
+
+			x = mustOpen(t, path)
+			defer x.Close()
+			page, err := x.Query(Query{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(ids(page.Entries)); got != "[camera_1/2024-11-02/0.jpg camera_1/2024-11-02/2.jpg]" {
+				t.Errorf("expected the entries around the failure after reopening, got %v", got)
+			}
+		})
+	}
+}
+
+func TestIndexCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "images.log")
+	x := mustOpen(t, path)
+	defer x.Close()
+
+	var deleted []string
+	for i := 0; i < compactMin; i++ {
+		e := entry("camera_1", i)
+		if err := x.Add(e); err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 {
+			deleted = append(deleted, e.ID)
+		}
+	}
+	before, _ := os.Stat(path)
+	if err := x.Delete(deleted...); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size()/10 {
+		t.Errorf("expected the log to be rewritten, size went from %d to %d", before.Size(), after.Size())
+	}
+
+	if err := x.Add(entry("camera_1", 2000)); err != nil {
+		t.Fatal(err)
+	}
+	reopened := mustOpen(t, path)
+	defer reopened.Close()
+	if reopened.Len() != 2 {
+		t.Errorf("expected 2 entries after compaction, got %d", reopened.Len())
+	}
+}
@@ -0,0 +1,367 @@
+// Package metrics is a small, dependency-free implementation of counters,
+// gauges and histograms rendered in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are latency buckets in seconds suitable for HTTP round trips.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry served by the collector's /metrics endpoint.
+var Default = NewRegistry()
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+type family interface {
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+// register returns the already registered family of the same name so that
+// metrics can be declared from several places without coordination.
+func (r *Registry) register(name string, create func() family) family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		return f
+	}
+	f := create()
+	r.families[name] = f
+	return f
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	f := r.register(name, func() family {
+		return &CounterVec{vec: newVec(name, help, counterType, labels, func() series { return &Counter{} })}
+	})
+	return f.(*CounterVec)
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	f := r.register(name, func() family {
+		return &GaugeVec{vec: newVec(name, help, gaugeType, labels, func() series { return &Gauge{} })}
+	})
+	return f.(*GaugeVec)
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	f := r.register(name, func() family {
+		return &HistogramVec{vec: newVec(name, help, histogramType, labels, func() series { return newHistogram(buckets) })}
+	})
+	return f.(*HistogramVec)
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn at scrape time.
+// Registering the same name again replaces the function.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families[name] = &gaugeFunc{name: name, help: help, fn: fn}
+}
+
+// Write renders every registered metric, sorted by name.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make([]family, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		families = append(families, r.families[name])
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+type series interface {
+	writeSeries(w *bufio.Writer, name, labels string)
+}
+
+type vec struct {
+	name   string
+	help   string
+	typ    metricType
+	labels []string
+	create func() series
+
+	mu     sync.RWMutex
+	series map[string]series
+	values map[string][]string
+}
+
+func newVec(name, help string, typ metricType, labels []string, create func() series) *vec {
+	return &vec{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		create: create,
+		series: make(map[string]series),
+		values: make(map[string][]string),
+	}
+}
+
+func (v *vec) with(values []string) series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.series[key]; ok {
+		return s
+	}
+	s = v.create()
+	v.series[key] = s
+	v.values[key] = append([]string(nil), values...)
+	return s
+}
+
+func (v *vec) delete(values []string) {
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.series, key)
+	delete(v.values, key)
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	writeHeader(w, v.name, v.help, v.typ)
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v.series[key].writeSeries(w, v.name, formatLabels(v.labels, v.values[key]))
+	}
+}
+
+type CounterVec struct{ *vec }
+
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	return v.with(labelValues).(*Counter)
+}
+
+func (v *CounterVec) Delete(labelValues ...string) { v.delete(labelValues) }
+
+type GaugeVec struct{ *vec }
+
+func (v *GaugeVec) With(labelValues ...string) *Gauge {
+	return v.with(labelValues).(*Gauge)
+}
+
+func (v *GaugeVec) Delete(labelValues ...string) { v.delete(labelValues) }
+
+type HistogramVec struct{ *vec }
+
+func (v *HistogramVec) With(labelValues ...string) *Histogram {
+	return v.with(labelValues).(*Histogram)
+}
+
+func (v *HistogramVec) Delete(labelValues ...string) { v.delete(labelValues) }
+
+type Counter struct {
+	bits atomic.Uint64
+}
+
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add increments the counter; negative values are ignored.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	addFloat(&c.bits, delta)
+}
+
+func (c *Counter) Value() float64 { return math.Float64frombits(c.bits.Load()) }
+
+func (c *Counter) writeSeries(w *bufio.Writer, name, labels string) {
+	writeSample(w, name, labels, c.Value())
+}
+
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+func (g *Gauge) Set(value float64) { g.bits.Store(math.Float64bits(value)) }
+func (g *Gauge) Add(delta float64) { addFloat(&g.bits, delta) }
+func (g *Gauge) Inc()              { g.Add(1) }
+func (g *Gauge) Dec()              { g.Add(-1) }
+func (g *Gauge) Value() float64    { return math.Float64frombits(g.bits.Load()) }
+
+func (g *Gauge) writeSeries(w *bufio.Writer, name, labels string) {
+	writeSample(w, name, labels, g.Value())
+}
+
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if value <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) writeSeries(w *bufio.Writer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		writeSample(w, name+"_bucket", withLabel(labels, "le", formatFloat(upper)), float64(h.counts[i]))
+	}
+	writeSample(w, name+"_bucket", withLabel(labels, "le", "+Inf"), float64(h.count))
+	writeSample(w, name+"_sum", labels, h.sum)
+	writeSample(w, name+"_count", labels, float64(h.count))
+}
+
+type gaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, gaugeType)
+	writeSample(w, g.name, "", g.fn())
+}
+
+func addFloat(bits *atomic.Uint64, delta float64) {
+	for {
+		old := bits.Load()
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if bits.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help string, typ metricType) {
+	if help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + value + `"`
+	if labels == "" {
+		return pair
+	}
+	return labels + "," + pair
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
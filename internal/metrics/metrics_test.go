@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+
+	errors := r.NewCounterVec("fetch_errors_total", "Failed fetches.", "camera")
+	errors.With("camera_1").Inc()
+	errors.With("camera_1").Add(2)
+	errors.With(`odd"cam`).Inc()
+
+	inflight := r.NewGaugeVec("inflight_requests", "Requests in flight.")
+	inflight.With().Inc()
+	inflight.With().Inc()
+	inflight.With().Dec()
+
+	latency := r.NewHistogramVec("fetch_duration_seconds", "Fetch latency.", []float64{0.1, 1}, "camera")
+	latency.With("camera_1").Observe(0.05)
+	latency.With("camera_1").Observe(0.5)
+	latency.With("camera_1").Observe(3)
+
+	r.NewGaugeFunc("spool_bytes", "Spool size.", func() float64 { return 42 })
+
+	var out strings.Builder
+	if err := r.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP fetch_duration_seconds Fetch latency.
+# TYPE fetch_duration_seconds histogram
+fetch_duration_seconds_bucket{camera="camera_1",le="0.1"} 1
+fetch_duration_seconds_bucket{camera="camera_1",le="1"} 2
+fetch_duration_seconds_bucket{camera="camera_1",le="+Inf"} 3
+fetch_duration_seconds_sum{camera="camera_1"} 3.55
+fetch_duration_seconds_count{camera="camera_1"} 3
+# HELP fetch_errors_total Failed fetches.
+# TYPE fetch_errors_total counter
+fetch_errors_total{camera="camera_1"} 3
+fetch_errors_total{camera="odd\"cam"} 1
+# HELP inflight_requests Requests in flight.
+# TYPE inflight_requests gauge
+inflight_requests 1
+# HELP spool_bytes Spool size.
+# TYPE spool_bytes gauge
+spool_bytes 42
+`
+	if out.String() != expected {
+		t.Errorf("unexpected exposition:\n%s\nwant:\n%s", out.String(), expected)
+	}
+}
+
+func TestRegistryReturnsExistingFamily(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("frames_total", "Frames.", "camera").With("a").Inc()
+	r.NewCounterVec("frames_total", "Frames.", "camera").With("a").Inc()
+
+	if v := r.NewCounterVec("frames_total", "Frames.", "camera").With("a").Value(); v != 2 {
+		t.Errorf("expected shared counter value 2, got %v", v)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("requests_total", "").With().Inc()
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %s", ct)
+	}
+	if !strings.Contains(w.Body.String(), "requests_total 1\n") {
+		t.Errorf("unexpected body:\n%s", w.Body.String())
+	}
+}
@@ -0,0 +1,377 @@
+// Package retention deletes stored frames as they age. Each camera keeps
+// every frame for a while, then one frame per interval, until the frames
+// expire; on top of that a global cap bounds the bytes kept, dropping the
+// oldest frames first.
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/duration"
+	"github.com/akhilesharora/turnaround-collector/internal/index"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+// Reasons a frame is deleted.
+const (
+	ReasonExpired     = "expired"
+	ReasonDownsampled = "downsampled"
+	ReasonDiskCap     = "disk_cap"
+)
+
+// batchSize is the number of deletions between progress logs.
+const batchSize = 500
+
+// pageSize is the number of entries read from the index at a time.
+const pageSize = 1000
+
+// Rule is the retention of one camera, or of every camera without a rule
+// of its own when Camera is empty. Zero durations disable their step.
+type Rule struct {
+	Camera string `json:"camera,omitempty"`
+	// KeepAll is how long every frame is kept before downsampling.
+	KeepAll duration.Duration `json:"keep_all"`
+	// DownsampleInterval keeps only the first frame of each interval once
+	// frames are older than KeepAll.
+	DownsampleInterval duration.Duration `json:"downsample_interval"`
+	// DeleteAfter is the age at which frames are deleted.
+	DeleteAfter duration.Duration `json:"delete_after"`
+}
+
+type Policy struct {
+	Rules []Rule `json:"rules"`
+	// MaxBytes caps the size of all stored frames; 0 means unlimited.
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+// LoadPolicy reads a policy from a JSON file.
+func LoadPolicy(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, err
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Policy{}, fmt.Errorf("parse retention policy %s: %w", path, err)
+	}
+	return p, p.Validate()
+}
+
+func (p Policy) Validate() error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i, r := range p.Rules {
+		if seen[r.Camera] {
+			errs = append(errs, fmt.Errorf("rules[%d]: duplicate rule for camera %q", i, r.Camera))
+		}
+		seen[r.Camera] = true
+		if r.KeepAll < 0 || r.DownsampleInterval < 0 || r.DeleteAfter < 0 {
+			errs = append(errs, fmt.Errorf("rules[%d]: durations must not be negative", i))
+		}
+		if r.DeleteAfter > 0 && r.DownsampleInterval > 0 && r.DeleteAfter <= r.KeepAll {
+			errs = append(errs, fmt.Errorf("rules[%d]: delete_after (%s) must be above keep_all (%s) to downsample",
+				i, time.Duration(r.DeleteAfter), time.Duration(r.KeepAll)))
+		}
+	}
+	if p.MaxBytes < 0 {
+		errs = append(errs, errors.New("max_bytes must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+func (p Policy) rule(cameraID string) Rule {
+	var fallback Rule
+	for _, r := range p.Rules {
+		if r.Camera == cameraID {
+			return r
+		}
+		if r.Camera == "" {
+			fallback = r
+		}
+	}
+	return fallback
+}
+
+// Deletion is a frame the policy removes, and why.
+type Deletion struct {
+	index.Entry
+	Reason string
+}
+
+// Plan lists the frames to delete, oldest first.
+type Plan struct {
+	Deletions []Deletion
+	Bytes     int64
+}
+
+// Plan works out what the policy deletes from entries, ordered by capture
+// time, at now.
+func (p Policy) Plan(entries []index.Entry, now time.Time) Plan {
+	var plan Plan
+	kept := p.planAges(&plan, entries, now, make(map[string]time.Time))
+	if p.MaxBytes > 0 {
+		excess := -p.MaxBytes
+		for _, e := range kept {
+			excess += e.Size
+		}
+		plan.capBytes(kept, excess)
+		plan.sort()
+	}
+	return plan
+}
+
+// planAges adds what the rules delete from entries, ordered by capture
+// time, to plan and returns the entries they keep. lastBucket holds the
+// downsampling interval of each camera's last kept frame, so entries can be
+// planned a page at a time.
+func (p Policy) planAges(plan *Plan, entries []index.Entry, now time.Time, lastBucket map[string]time.Time) []index.Entry {
+	var kept []index.Entry
+	for _, e := range entries {
+		r := p.rule(e.CameraID)
+		age := now.Sub(e.CapturedAt)
+		switch {
+		case r.DeleteAfter > 0 && age > time.Duration(r.DeleteAfter):
+			plan.add(e, ReasonExpired)
+			continue
+		case r.DownsampleInterval > 0 && age > time.Duration(r.KeepAll):
+			bucket := e.CapturedAt.Truncate(time.Duration(r.DownsampleInterval))
+			if last, ok := lastBucket[e.CameraID]; ok && last.Equal(bucket) {
+				plan.add(e, ReasonDownsampled)
+				continue
+			}
+			lastBucket[e.CameraID] = bucket
+		}
+		kept = append(kept, e)
+	}
+	return kept
+}
+
+// minAge returns the youngest age at which a rule deletes frames; false
+// means no rule ever does.
+func (p Policy) minAge() (time.Duration, bool) {
+	var youngest time.Duration
+	found := false
+	consider := func(d duration.Duration) {
+		if !found || time.Duration(d) < youngest {
+			youngest, found = time.Duration(d), true
+		}
+	}
+	for _, r := range p.Rules {
+		if r.DownsampleInterval > 0 {
+			consider(r.KeepAll)
+		}
+		if r.DeleteAfter > 0 {
+			consider(r.DeleteAfter)
+		}
+	}
+	return youngest, found
+}
+
+func (p *Plan) add(e index.Entry, reason string) {
+	p.Deletions = append(p.Deletions, Deletion{Entry: e, Reason: reason})
+	p.Bytes += e.Size
+}
+
+// capBytes deletes entries, oldest first, until excess bytes are freed, and
+// returns the excess left.
+func (p *Plan) capBytes(entries []index.Entry, excess int64) int64 {
+	for _, e := range entries {
+		if excess <= 0 {
+			break
+		}
+		p.add(e, ReasonDiskCap)
+		excess -= e.Size
+	}
+	return excess
+}
+
+func (p *Plan) sort() {
+	sort.SliceStable(p.Deletions, func(i, j int) bool {
+		return p.Deletions[i].CapturedAt.Before(p.Deletions[j].CapturedAt)
+	})
+}
+
+// Summary counts the deletions and their bytes per camera and reason.
+type Summary struct {
+	Camera string
+	Reason string
+	Frames int
+	Bytes  int64
+}
+
+func (p Plan) Summary() []Summary {
+	type key struct{ camera, reason string }
+	positions := make(map[key]int)
+	var summary []Summary
+	for _, d := range p.Deletions {
+		k := key{d.CameraID, d.Reason}
+		i, ok := positions[k]
+		if !ok {
+			i = len(summary)
+			positions[k] = i
+			summary = append(summary, Summary{Camera: d.CameraID, Reason: d.Reason})
+		}
+		summary[i].Frames++
+		summary[i].Bytes += d.Size
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Camera != summary[j].Camera {
+			return summary[i].Camera < summary[j].Camera
+		}
+		return summary[i].Reason < summary[j].Reason
+	})
+	return summary
+}
+
+// Manager applies a policy to the frames of an index and their store.
+type Manager struct {
+	index  *index.Index
+	store  interfaces.ImageStore
+	policy Policy
+	logger interfaces.Logger
+	dryRun bool
+}
+
+func NewManager(idx *index.Index, store interfaces.ImageStore, policy Policy, logger interfaces.Logger) *Manager {
+	return &Manager{index: idx, store: store, policy: policy, logger: logger}
+}
+
+// SetDryRun makes the manager only report what it would delete. It must be
+// called before the manager is used.
+func (m *Manager) SetDryRun(dryRun bool) {
+	m.dryRun = dryRun
+}
+
+// Plan works out what the policy deletes now. The index is read a page at
+// a time: first every frame older than the youngest age at which a rule
+// acts, then, while the frames kept exceed MaxBytes, the oldest of the rest.
+func (m *Manager) Plan(now time.Time) (Plan, error) {
+	var plan Plan
+	if age, ok := m.policy.minAge(); ok {
+		lastBucket := make(map[string]time.Time)
+		q := index.Query{To: now.Add(-age), Limit: pageSize}
+		for {
+			page, err := m.index.Query(q)
+			if err != nil {
+				return Plan{}, err
+			}
+			m.policy.planAges(&plan, page.Entries, now, lastBucket)
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+	}
+	if m.policy.MaxBytes == 0 {
+		return plan, nil
+	}
+	excess := m.index.Size() - plan.Bytes - m.policy.MaxBytes
+	if excess <= 0 {
+		return plan, nil
+	}
+
+	planned := make(map[string]bool, len(plan.Deletions))
+	for _, d := range plan.Deletions {
+		planned[d.ID] = true
+	}
+	q := index.Query{Limit: pageSize}
+	for excess > 0 {
+		page, err := m.index.Query(q)
+		if err != nil {
+			return Plan{}, err
+		}
+		var kept []index.Entry
+		for _, e := range page.Entries {
+			if !planned[e.ID] {
+				kept = append(kept, e)
+			}
+		}
+		excess = plan.capBytes(kept, excess)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	plan.sort()
+	return plan, nil
+}
+
+// Enforce deletes what the policy deletes now, or in dry-run mode logs the
+// report. Frames are removed from the store before the index, so an
+// interrupted run leaves at most index entries whose image is gone, which
+// the next run deletes again.
+func (m *Manager) Enforce(ctx context.Context, now time.Time) (Plan, error) {
+	start := time.Now()
+	plan, err := m.Plan(now)
+	if err != nil {
+		return plan, err
+	}
+	for _, s := range plan.Summary() {
+		m.logger.Info("Retention report",
+			logging.KeyCameraID, s.Camera,
+			"reason", s.Reason,
+			"frames", s.Frames,
+			logging.KeyBytes, s.Bytes,
+			"dry_run", m.dryRun,
+		)
+	}
+	if m.dryRun || len(plan.Deletions) == 0 {
+		return plan, nil
+	}
+
+	var deleted int
+	var bytes int64
+	for deleted < len(plan.Deletions) {
+		batch := plan.Deletions[deleted:min(deleted+batchSize, len(plan.Deletions))]
+		ids := make([]string, 0, len(batch))
+		for _, d := range batch {
+			if err := ctx.Err(); err != nil {
+				return plan, errors.Join(err, m.index.Delete(ids...))
+			}
+			if err := m.store.Delete(ctx, d.Key); err != nil {
+				return plan, errors.Join(fmt.Errorf("delete %s: %w", d.Key, err), m.index.Delete(ids...))
+			}
+			ids = append(ids, d.ID)
+			bytes += d.Size
+		}
+		if err := m.index.Delete(ids...); err != nil {
+			return plan, err
+		}
+		deleted += len(batch)
+		m.logger.Info("Retention progress",
+			"deleted", deleted,
+			"total", len(plan.Deletions),
+			logging.KeyBytes, bytes,
+		)
+	}
+	m.logger.Info("Retention complete",
+		"deleted", deleted,
+		logging.KeyBytes, bytes,
+		"remaining", m.index.Len(),
+		"duration", time.Since(start),
+	)
+	return plan, nil
+}
+
+// Run enforces the policy every interval until ctx is done.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := m.Enforce(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			m.logger.Error("Retention failed", logging.KeyError, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
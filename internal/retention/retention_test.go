@@ -0,0 +1,291 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/duration"
+	"github.com/akhilesharora/turnaround-collector/internal/index"
+	"github.com/akhilesharora/turnaround-collector/internal/storage"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	testutil "github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+var now = time.Date(2024, 11, 10, 12, 0, 0, 0, time.UTC)
+
+// frames returns one 100-byte frame per step for camera, the newest at age newest.
+func frames(camera string, count int, step, newest time.Duration) []index.Entry {
+	var entries []index.Entry
+	for i := count - 1; i >= 0; i-- {
+		at := now.Add(-newest - time.Duration(i)*step)
+		key := fmt.Sprintf("%s/%s.jpg", camera, at.Format("20060102T150405"))
+		entries = append(entries, index.Entry{ID: index.ID(key), CameraID: camera, CapturedAt: at, Size: 100, Key: key})
+	}
+	return entries
+}
+
+// byCaptureTime orders entries as the index returns them.
+func byCaptureTime(entries []index.Entry) []index.Entry {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CapturedAt.Before(entries[j].CapturedAt) })
+	return entries
+}
+
+func hours(h float64) duration.Duration {
+	return duration.Duration(time.Duration(h * float64(time.Hour)))
+}
+
+func TestPolicyPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		entries  []index.Entry
+		expected map[string]int // deletions per reason
+	}{
+		{
+			name:    "no rules",
+			entries: frames("camera_1", 10, time.Hour, 0),
+		},
+		{
+			name:     "expired",
+			policy:   Policy{Rules: []Rule{{DeleteAfter: hours(48)}}},
+			entries:  frames("camera_1", 10, 24*time.Hour, 0),
+			expected: map[string]int{ReasonExpired: 7},
+		},
+		{
+			name:   "downsampled to one per minute",
+			policy: Policy{Rules: []Rule{{KeepAll: hours(1), DownsampleInterval: duration.Duration(time.Minute)}}},
+			// Every 15s for 2h: the 239 frames older than an hour span 60 minutes
+			entries:  frames("camera_1", 480, 15*time.Second, 0),
+			expected: map[string]int{ReasonDownsampled: 239 - 60},
+		},
+		{
+			name: "per camera rule",
+			policy: Policy{Rules: []Rule{
+				{DeleteAfter: hours(48)},
+				{Camera: "camera_2", DeleteAfter: hours(12)},
+			}},
+			entries:  byCaptureTime(append(frames("camera_1", 4, 24*time.Hour, time.Hour), frames("camera_2", 4, 24*time.Hour, time.Hour)...)),
+			expected: map[string]int{ReasonExpired: 2 + 3},
+		},
+		{
+			name:     "disk cap drops the oldest",
+			policy:   Policy{MaxBytes: 450},
+			entries:  frames("camera_1", 10, time.Hour, 0),
+			expected: map[string]int{ReasonDiskCap: 6},
+		},
+		{
+			name:     "disk cap counts what the rules already delete",
+			policy:   Policy{Rules: []Rule{{DeleteAfter: hours(5.5)}}, MaxBytes: 450},
+			entries:  frames("camera_1", 10, time.Hour, 0),
+			expected: map[string]int{ReasonExpired: 4, ReasonDiskCap: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := tt.policy.Plan(tt.entries, now)
+			got := make(map[string]int)
+			var bytes int64
+			for i, d := range plan.Deletions {
+				got[d.Reason]++
+				bytes += d.Size
+				if i > 0 && d.CapturedAt.Before(plan.Deletions[i-1].CapturedAt) {
+					t.Error("expected deletions oldest first")
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Errorf("expected deletions %v, got %v", tt.expected, got)
+			}
+			if bytes != plan.Bytes {
+				t.Errorf("expected %d planned bytes, got %d", bytes, plan.Bytes)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	p := Policy{
+		Rules: []Rule{
+			{Camera: "camera_1", KeepAll: hours(48), DownsampleInterval: duration.Duration(time.Minute), DeleteAfter: hours(24)},
+			{Camera: "camera_1", DeleteAfter: -1},
+		},
+		MaxBytes: -1,
+	}
+	err := p.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		"rules[0]: delete_after (24h0m0s) must be above keep_all (48h0m0s)",
+		`rules[1]: duplicate rule for camera "camera_1"`,
+		"rules[1]: durations must not be negative",
+		"max_bytes must not be negative",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q, got:\n%v", expected, err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "retention.json")
+	os.WriteFile(path, []byte(`{"rules": [{"keep_all": "24h", "downsample_interval": "1m", "delete_after": "720h"}], "max_bytes": 1000}`), 0o644)
+	loaded, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.MaxBytes != 1000 || len(loaded.Rules) != 1 || time.Duration(loaded.Rules[0].DeleteAfter) != 720*time.Hour {
+		t.Errorf("unexpected policy %+v", loaded)
+	}
+}
+
+func TestManagerEnforce(t *testing.T) {
+	for _, dryRun := range []bool{true, false} {
+		t.Run(fmt.Sprintf("dry run %v", dryRun), func(t *testing.T) {
+			idx, err := index.Open(filepath.Join(t.TempDir(), "images.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer idx.Close()
+			store := storage.NewMemoryStore()
+			ctx := context.Background()
+			for _, e := range frames("camera_1", 1200, time.Hour, 0) {
+				store.Put(ctx, e.Key, []byte("frame"))
+				idx.Add(e)
+			}
+
+			logger := &testutil.MockLogger{}
+			m := NewManager(idx, store, Policy{Rules: []Rule{{DeleteAfter: hours(100.5)}}}, logger)
+			m.SetDryRun(dryRun)
+			plan, err := m.Enforce(ctx, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(plan.Deletions) != 1099 {
+				t.Fatalf("expected 1099 planned deletions, got %d", len(plan.Deletions))
+			}
+
+			expected := 101
+			if dryRun {
+				expected = 1200
+			}
+			if idx.Len() != expected || store.Len() != expected {
+				t.Errorf("expected %d frames left, got %d indexed and %d stored", expected, idx.Len(), store.Len())
+			}
+
+			var report, progress int
+			for _, log := range logger.Logs {
+				if strings.Contains(log, "Retention report") && strings.Contains(log, "1099") {
+					report++
+				}
+				if strings.Contains(log, "Retention progress") {
+					progress++
+				}
+			}
+			if report != 1 {
+				t.Errorf("expected one report line, got %v", logger.Logs)
+			}
+			if expectedProgress := map[bool]int{true: 0, false: 3}[dryRun]; progress != expectedProgress {
+				t.Errorf("expected %d progress lines, got %d", expectedProgress, progress)
+			}
+		})
+	}
+}
+
+func TestManagerPlan(t *testing.T) {
+	idx, err := index.Open(filepath.Join(t.TempDir(), "images.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	// More frames than fit in a page, so downsampling carries across pages
+	entries := byCaptureTime(append(frames("camera_1", 1500, 90*time.Second, 0), frames("camera_2", 1000, 2*time.Minute, time.Second)...))
+	for _, e := range entries {
+		idx.Add(e)
+	}
+
+	// Reading only what can be deleted must plan what reading everything does
+	policies := map[string]Policy{
+		"no rules":  {},
+		"expired":   {Rules: []Rule{{DeleteAfter: hours(20)}}},
+		"disk cap":  {MaxBytes: 12345},
+		"under cap": {MaxBytes: 1 << 20},
+		"combined": {
+			Rules: []Rule{
+				{KeepAll: hours(2), DownsampleInterval: hours(1), DeleteAfter: hours(30)},
+				{Camera: "camera_2", KeepAll: hours(6), DownsampleInterval: hours(3)},
+			},
+			MaxBytes: 20000,
+		},
+	}
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			expected := policy.Plan(entries, now)
+			got, err := NewManager(idx, storage.NewMemoryStore(), policy, &testutil.MockLogger{}).Plan(now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Errorf("expected %d deletions of %d bytes, got %d of %d",
+					len(expected.Deletions), expected.Bytes, len(got.Deletions), got.Bytes)
+			}
+		})
+	}
+}
+
+// failingStore fails the deletion numbered failAt.
+type failingStore struct {
+	interfaces.ImageStore
+	deletes, failAt int
+}
+
+func (s *failingStore) Delete(ctx context.Context, key string) error {
+	if s.deletes++; s.deletes == s.failAt {
+		return errStore
+	}
+	return s.ImageStore.Delete(ctx, key)
+}
+
+var errStore = errors.New("disk gone")
+
+func TestManagerEnforceFailure(t *testing.T) {
+	for _, closed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("index closed %v", closed), func(t *testing.T) {
+			idx, err := index.Open(filepath.Join(t.TempDir(), "images.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer idx.Close()
+			store := &failingStore{ImageStore: storage.NewMemoryStore(), failAt: 3}
+			ctx := context.Background()
+			for _, e := range frames("camera_1", 10, time.Hour, 0) {
+				store.Put(ctx, e.Key, []byte("frame"))
+				idx.Add(e)
+			}
+			if closed {
+				idx.Close()
+			}
+
+			m := NewManager(idx, store, Policy{Rules: []Rule{{DeleteAfter: hours(4.5)}}}, &testutil.MockLogger{})
+			_, err = m.Enforce(ctx, now)
+			if !errors.Is(err, errStore) {
+				t.Fatalf("expected the store error, got %v", err)
+			}
+			if closed {
+				if !errors.Is(err, index.ErrClosed) {
+					t.Errorf("expected the index error to be reported too, got %v", err)
+				}
+				return
+			}
+			// The two frames deleted before the failure leave the index
+			if idx.Len() != 8 {
+				t.Errorf("expected 8 indexed frames, got %d", idx.Len())
+			}
+		})
+	}
+}
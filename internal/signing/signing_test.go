@@ -0,0 +1,103 @@
+package signing
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+)
+
+func TestSignValid(t *testing.T) {
+	key := Key{ID: "k1", Secret: "secret"}
+	h := http.Header{}
+	h.Set(interfaces.HeaderCameraID, "camera_1")
+	h.Set(interfaces.HeaderCaptureTime, "2024-11-02T10:15:30Z")
+	key.Sign(h, http.MethodPost, "/image", "ABCD", time.Unix(1700000000, 0))
+
+	if h.Get(HeaderKeyID) != "k1" || h.Get(HeaderTimestamp) != "1700000000" || h.Get(HeaderNonce) == "" {
+		t.Fatalf("unexpected headers %v", h)
+	}
+	signature := h.Get(HeaderSignature)
+
+	tests := []struct {
+		name     string
+		key      Key
+		method   string
+		path     string
+		bodyHash string
+		// tamper changes a metadata header after signing
+		tamper   [2]string
+		expected bool
+	}{
+		{name: "same request", key: key, method: http.MethodPost, path: "/image", bodyHash: "abcd", expected: true},
+		{name: "other body", key: key, method: http.MethodPost, path: "/image", bodyHash: "abce"},
+		{name: "other path", key: key, method: http.MethodPost, path: "/other", bodyHash: "abcd"},
+		{name: "other method", key: key, method: http.MethodPut, path: "/image", bodyHash: "abcd"},
+		{name: "other secret", key: Key{ID: "k1", Secret: "guess"}, method: http.MethodPost, path: "/image", bodyHash: "abcd"},
+		{name: "other camera", key: key, method: http.MethodPost, path: "/image", bodyHash: "abcd",
+			tamper: [2]string{interfaces.HeaderCameraID, "camera_2"}},
+		{name: "other capture time", key: key, method: http.MethodPost, path: "/image", bodyHash: "abcd",
+			tamper: [2]string{interfaces.HeaderCaptureTime, "2024-11-03T10:15:30Z"}},
+		{name: "other fetch latency", key: key, method: http.MethodPost, path: "/image", bodyHash: "abcd",
+			tamper: [2]string{interfaces.HeaderFetchLatency, "1ms"}},
+		{name: "added idempotency key", key: key, method: http.MethodPost, path: "/image", bodyHash: "abcd",
+			tamper: [2]string{interfaces.HeaderIdempotencyKey, "k"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := h.Clone()
+			if tt.tamper[0] != "" {
+				header.Set(tt.tamper[0], tt.tamper[1])
+			}
+			if got := tt.key.Valid(signature, header, tt.method, tt.path, tt.bodyHash); got != tt.expected {
+				t.Errorf("expected valid=%v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	other := http.Header{}
+	key.Stamp(other, time.Unix(1700000000, 0))
+	if other.Get(HeaderNonce) == h.Get(HeaderNonce) {
+		t.Error("expected every request to get a fresh nonce")
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectedErr string
+		expected    int
+	}{
+		{name: "two keys", content: `[{"id":"a","client":"collector","secret":"x"},{"id":"b","client":"collector","secret":"y"}]`, expected: 2},
+		{name: "empty", content: `[]`, expectedErr: "no keys"},
+		{name: "missing secret", content: `[{"id":"a"}]`, expectedErr: "id and a secret"},
+		{name: "duplicate id", content: `[{"id":"a","secret":"x"},{"id":"a","secret":"y"}]`, expectedErr: "duplicate"},
+		{name: "malformed", content: `{`, expectedErr: "parse keys"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			keys, err := LoadKeys(path)
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != tt.expected {
+				t.Errorf("expected %d keys, got %d", tt.expected, len(keys))
+			}
+		})
+	}
+}
@@ -0,0 +1,593 @@
+// Package spool implements a durable, append-only, disk-backed FIFO queue.
+//
+// Records are appended to numbered segment files and fsynced before Append
+// returns. A single consumer reads records with Next and confirms them with
+// Ack; the acknowledged position is persisted, so anything appended but not
+// acknowledged is delivered again after a restart (at-least-once).
+package spool
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrFull    = errors.New("spool full")
+	ErrCorrupt = errors.New("spool segment corrupt")
+	ErrClosed  = errors.New("spool closed")
+)
+
+type EvictionPolicy string
+
+const (
+	DropOldest EvictionPolicy = "drop-oldest"
+	DropNewest EvictionPolicy = "drop-newest"
+)
+
+func ParseEvictionPolicy(s string) (EvictionPolicy, error) {
+	switch p := EvictionPolicy(s); p {
+	case DropOldest, DropNewest:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown eviction policy %q (want %s or %s)", s, DropOldest, DropNewest)
+	}
+}
+
+type Options struct {
+	// MaxBytes caps the on-disk size of the spool; 0 means unlimited.
+	MaxBytes int64
+	// MaxAge drops records older than this instead of delivering them; 0 means unlimited.
+	MaxAge time.Duration
+	// SegmentSize is the size at which a new segment file is started.
+	SegmentSize int64
+	// Eviction decides what to drop when MaxBytes would be exceeded.
+	Eviction EvictionPolicy
+}
+
+const (
+	defaultSegmentSize = 16 << 20
+
+	// length(4) + crc32(4) + unix nanos(8)
+	headerSize = 16
+	ackSize    = 20
+	segmentExt = ".seg"
+	ackFile    = "ack"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type Record struct {
+	Data []byte
+	Time time.Time
+
+	segment uint64
+	offset  int64
+	next    int64
+}
+
+type Stats struct {
+	// Bytes is the on-disk size, Pending the part not yet acknowledged.
+	Bytes           int64
+	Pending         int64
+	Segments        int
+	EvictedBytes    int64
+	ExpiredRecords  int64
+	CorruptSegments int64
+}
+
+type segment struct {
+	id        uint64
+	path      string
+	size      int64
+	lastWrite time.Time
+}
+
+// segmentFile is the segment being appended to.
+type segmentFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+type Spool struct {
+	dir  string
+	opts Options
+
+	mu       sync.Mutex
+	segments []*segment // oldest first; the last one is being appended to
+	active   segmentFile
+	reader   *os.File
+	readID   uint64
+	ackOff   int64 // acknowledged offset within segments[0]
+	size     int64
+	stats    Stats
+	notify   chan struct{}
+	closed   bool
+}
+
+func Open(dir string, opts Options) (*Spool, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if opts.MaxBytes > 0 && opts.SegmentSize > opts.MaxBytes/4 {
+		// Keep segments small enough that drop-oldest can free space gradually
+		opts.SegmentSize = max(opts.MaxBytes/4, headerSize)
+	}
+	if opts.Eviction == "" {
+		opts.Eviction = DropOldest
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+
+	s := &Spool{
+		dir:    dir,
+		opts:   opts,
+		notify: make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("read spool dir: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("stat segment: %w", err)
+		}
+		s.segments = append(s.segments, &segment{
+			id:        id,
+			path:      filepath.Join(s.dir, name),
+			size:      info.Size(),
+			lastWrite: info.ModTime(),
+		})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+
+	ackID, ackOff, err := s.readAck()
+	if err != nil {
+		return err
+	}
+
+	// Segments fully consumed before the last shutdown
+	for len(s.segments) > 0 && s.segments[0].id < ackID {
+		if err := os.Remove(s.segments[0].path); err != nil {
+			return fmt.Errorf("remove consumed segment: %w", err)
+		}
+		s.segments = s.segments[1:]
+	}
+	if len(s.segments) > 0 && s.segments[0].id == ackID {
+		s.ackOff = ackOff
+	}
+
+	if len(s.segments) == 0 {
+		return s.roll(ackID + 1)
+	}
+
+	last := s.segments[len(s.segments)-1]
+	if err := s.recoverTail(last); err != nil {
+		return err
+	}
+	active, err := os.OpenFile(last.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open active segment: %w", err)
+	}
+	s.active = active
+	for _, seg := range s.segments {
+		s.size += seg.size
+	}
+	return nil
+}
+
+// recoverTail truncates a torn or corrupt record left at the end of the
+// active segment by a crash mid-append.
+func (s *Spool) recoverTail(seg *segment) error {
+	f, err := os.OpenFile(seg.path, os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("open segment: %w", err)
+	}
+	defer f.Close()
+
+	var off int64
+	for off < seg.size {
+		_, next, err := readRecord(f, off, seg.size)
+		if err != nil {
+			break
+		}
+		off = next
+	}
+	if off == seg.size {
+		return nil
+	}
+	if err := f.Truncate(off); err != nil {
+		return fmt.Errorf("truncate torn segment: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync segment: %w", err)
+	}
+	seg.size = off
+	return nil
+}
+
+// Append durably writes data to the spool.
+func (s *Spool) Append(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	s.expireSegments()
+
+	size := int64(headerSize + len(data))
+	if s.opts.MaxBytes > 0 {
+		if size > s.opts.MaxBytes {
+			return fmt.Errorf("record of %d bytes exceeds spool limit: %w", size, ErrFull)
+		}
+		for s.size+size > s.opts.MaxBytes {
+			if s.opts.Eviction == DropNewest {
+				return ErrFull
+			}
+			if err := s.dropOldest(); err != nil {
+				return err
+			}
+		}
+	}
+
+	active := s.segments[len(s.segments)-1]
+	if active.size > 0 && active.size+size > s.opts.SegmentSize {
+		if err := s.roll(active.id + 1); err != nil {
+			return err
+		}
+		active = s.segments[len(s.segments)-1]
+	}
+
+	buf := make([]byte, size)
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(time.Now().UnixNano()))
+	copy(buf[headerSize:], data)
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(buf[8:], crcTable))
+
+	if err := s.write(active, buf); err != nil {
+		return err
+	}
+	active.size += size
+	active.lastWrite = time.Now()
+	s.size += size
+
+	close(s.notify)
+	s.notify = make(chan struct{})
+	return nil
+}
+
+// write appends buf to the active segment. A failed write or sync may leave
+// part of buf behind, so the segment is cut back to its last complete record
+// and later records do not land behind garbage; if that fails too, appends
+// continue in a new segment. As the segment is opened for appending, writes
+// resume at the truncated end.
+func (s *Spool) write(seg *segment, buf []byte) error {
+	_, err := s.active.Write(buf)
+	if err != nil {
+		err = fmt.Errorf("write segment: %w", err)
+	} else if err = s.active.Sync(); err != nil {
+		err = fmt.Errorf("sync segment: %w", err)
+	}
+	if err == nil {
+		return nil
+	}
+	if truncErr := s.active.Truncate(seg.size); truncErr != nil {
+		return errors.Join(err, fmt.Errorf("truncate segment: %w", truncErr), s.roll(seg.id+1))
+	}
+	return err
+}
+
+// Next blocks until a record is available and returns the oldest
+// unacknowledged one. Calling Next again without Ack returns the same record.
+// ErrCorrupt is returned once for a damaged segment, which is then skipped.
+func (s *Spool) Next(ctx context.Context) (Record, error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return Record{}, ErrClosed
+		}
+		rec, ok, err := s.head()
+		notify := s.notify
+		s.mu.Unlock()
+
+		if err != nil || ok {
+			return rec, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return Record{}, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+func (s *Spool) head() (Record, bool, error) {
+	for {
+		seg := s.segments[0]
+		if s.ackOff >= seg.size {
+			if len(s.segments) == 1 {
+				return Record{}, false, nil
+			}
+			if err := s.removeHead(); err != nil {
+				return Record{}, false, err
+			}
+			continue
+		}
+
+		reader, err := s.openReader(seg)
+		if err != nil {
+			return Record{}, false, err
+		}
+		rec, next, err := readRecord(reader, s.ackOff, seg.size)
+		if err != nil {
+			offset := s.ackOff
+			s.stats.CorruptSegments++
+			s.ackOff = seg.size
+			if err := s.writeAck(); err != nil {
+				return Record{}, false, err
+			}
+			return Record{}, false, fmt.Errorf("segment %d at offset %d: %w", seg.id, offset, ErrCorrupt)
+		}
+
+		if s.opts.MaxAge > 0 && time.Since(rec.Time) > s.opts.MaxAge {
+			s.stats.ExpiredRecords++
+			s.ackOff = next
+			if err := s.writeAck(); err != nil {
+				return Record{}, false, err
+			}
+			continue
+		}
+
+		rec.segment = seg.id
+		rec.offset = s.ackOff
+		rec.next = next
+		return rec, true, nil
+	}
+}
+
+// Ack confirms delivery of rec so it is never returned again. Acks for
+// records that were evicted in the meantime are ignored.
+func (s *Spool) Ack(rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if rec.segment != s.segments[0].id || rec.offset != s.ackOff {
+		return nil
+	}
+	s.ackOff = rec.next
+	if s.ackOff >= s.segments[0].size && len(s.segments) > 1 {
+		return s.removeHead()
+	}
+	return s.writeAck()
+}
+
+func (s *Spool) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	stats.Bytes = s.size
+	stats.Pending = s.size - s.ackOff
+	stats.Segments = len(s.segments)
+	return stats
+}
+
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.notify)
+	return s.closeFiles()
+}
+
+func (s *Spool) closeFiles() error {
+	var errs []error
+	if s.active != nil {
+		errs = append(errs, s.active.Close())
+	}
+	if s.reader != nil {
+		errs = append(errs, s.reader.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// dropOldest evicts the oldest segment, rolling the active one first if it
+// is the only segment left.
+func (s *Spool) dropOldest() error {
+	if len(s.segments) == 1 {
+		if s.segments[0].size == 0 {
+			return ErrFull
+		}
+		if err := s.roll(s.segments[0].id + 1); err != nil {
+			return err
+		}
+	}
+	s.stats.EvictedBytes += s.segments[0].size
+	return s.removeHead()
+}
+
+// expireSegments drops whole segments whose newest record is past MaxAge.
+func (s *Spool) expireSegments() {
+	if s.opts.MaxAge <= 0 {
+		return
+	}
+	for len(s.segments) > 1 && time.Since(s.segments[0].lastWrite) > s.opts.MaxAge {
+		s.stats.EvictedBytes += s.segments[0].size
+		if err := s.removeHead(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Spool) removeHead() error {
+	seg := s.segments[0]
+	if s.reader != nil && s.readID == seg.id {
+		s.reader.Close()
+		s.reader = nil
+	}
+	if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove segment: %w", err)
+	}
+	s.size -= seg.size
+	s.segments = s.segments[1:]
+	s.ackOff = 0
+	return s.writeAck()
+}
+
+func (s *Spool) roll(id uint64) error {
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("create segment: %w", err)
+	}
+	if err := syncDir(s.dir); err != nil {
+		f.Close()
+		return err
+	}
+	if s.active != nil {
+		s.active.Close()
+	}
+	s.active = f
+	s.segments = append(s.segments, &segment{id: id, path: path, lastWrite: time.Now()})
+	return nil
+}
+
+func (s *Spool) openReader(seg *segment) (*os.File, error) {
+	if s.reader != nil && s.readID == seg.id {
+		return s.reader, nil
+	}
+	if s.reader != nil {
+		s.reader.Close()
+	}
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return nil, fmt.Errorf("open segment: %w", err)
+	}
+	s.reader = f
+	s.readID = seg.id
+	return f, nil
+}
+
+func (s *Spool) readAck() (uint64, int64, error) {
+	buf, err := os.ReadFile(filepath.Join(s.dir, ackFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("read ack: %w", err)
+	}
+	if len(buf) != ackSize || crc32.Checksum(buf[:16], crcTable) != binary.LittleEndian.Uint32(buf[16:]) {
+		return 0, 0, fmt.Errorf("ack file: %w", ErrCorrupt)
+	}
+	return binary.LittleEndian.Uint64(buf[0:8]), int64(binary.LittleEndian.Uint64(buf[8:16])), nil
+}
+
+// writeAck persists the consumer position with write-to-temp, fsync, rename.
+func (s *Spool) writeAck() error {
+	buf := make([]byte, ackSize)
+	binary.LittleEndian.PutUint64(buf[0:8], s.segments[0].id)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(s.ackOff))
+	binary.LittleEndian.PutUint32(buf[16:], crc32.Checksum(buf[:16], crcTable))
+
+	tmp := filepath.Join(s.dir, ackFile+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("write ack: %w", err)
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return fmt.Errorf("write ack: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync ack: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write ack: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, ackFile)); err != nil {
+		return fmt.Errorf("write ack: %w", err)
+	}
+	return syncDir(s.dir)
+}
+
+func readRecord(r io.ReaderAt, off, limit int64) (Record, int64, error) {
+	if limit-off < headerSize {
+		return Record{}, 0, io.ErrUnexpectedEOF
+	}
+	header := make([]byte, headerSize)
+	if _, err := r.ReadAt(header, off); err != nil {
+		return Record{}, 0, err
+	}
+	length := int64(binary.LittleEndian.Uint32(header[0:4]))
+	if limit-off-headerSize < length {
+		return Record{}, 0, io.ErrUnexpectedEOF
+	}
+
+	buf := make([]byte, 8+length)
+	copy(buf, header[8:])
+	if _, err := r.ReadAt(buf[8:], off+headerSize); err != nil {
+		return Record{}, 0, err
+	}
+	if crc32.Checksum(buf, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return Record{}, 0, ErrCorrupt
+	}
+
+	return Record{
+		Data: buf[8:],
+		Time: time.Unix(0, int64(binary.LittleEndian.Uint64(buf[0:8]))),
+	}, off + headerSize + length, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open spool dir: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync spool dir: %w", err)
+	}
+	return nil
+}
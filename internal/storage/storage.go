@@ -0,0 +1,201 @@
+// Package storage keeps received images. FileStore lays them out on a local
+// filesystem by camera and date; other backends, such as an S3-compatible
+// object store, implement the same interfaces.ImageStore and can be tested
+// against MemoryStore.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+)
+
+// tmpPrefix marks files being written; they are renamed into place once
+// complete, so readers never see a partial image.
+const tmpPrefix = ".tmp-"
+
+// Key places a frame under its camera and capture date in UTC, for example
+// camera_1/2024-11-02/101530.123456789-9.jpg. Frames without a capture
+// time are filed by receivedAt.
+func Key(meta interfaces.ImageMetadata, receivedAt time.Time) string {
+	at := meta.CapturedAt
+	if at.IsZero() {
+		at = receivedAt
+	}
+	at = at.UTC()
+	name := at.Format("150405.000000000") + "-" + strconv.FormatUint(meta.Sequence, 10) + ".jpg"
+	return path.Join(partition(meta.CameraID), at.Format("2006-01-02"), name)
+}
+
+// partition turns a camera ID into a safe directory name.
+func partition(cameraID string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, cameraID)
+	if name == "" || name[0] == '.' {
+		name = "_" + name
+	}
+	return name
+}
+
+func checkKey(key string) error {
+	if !fs.ValidPath(key) || key == "." || strings.HasPrefix(path.Base(key), tmpPrefix) {
+		return fmt.Errorf("invalid image key %q", key)
+	}
+	return nil
+}
+
+// FileStore keeps images as files below a directory.
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create storage dir: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+// Put writes data to a temporary file next to its destination, syncs it
+// and renames it into place.
+func (s *FileStore) Put(ctx context.Context, key string, data []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dest := s.path(key)
+	dir := filepath.Dir(dest)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create image dir: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, tmpPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("write image: %w", err)
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("write image: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("sync image: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write image: %w", err)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write image: %w", err)
+	}
+	return syncDir(dir)
+}
+
+func (s *FileStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	return os.Open(s.path(key))
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete image: %w", err)
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open image dir: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync image dir: %w", err)
+	}
+	return nil
+}
+
+// MemoryStore keeps images in memory. It stands in for remote stores in
+// tests.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	images map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{images: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, data []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.images[key] = bytes.Clone(data)
+	return nil
+}
+
+func (s *MemoryStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.images[key]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: key, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.images, key)
+	return nil
+}
+
+// Len returns the number of images held.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.images)
+}
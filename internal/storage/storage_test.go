@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+)
+
+func TestKey(t *testing.T) {
+	received := time.Date(2024, 11, 3, 0, 0, 1, 0, time.UTC)
+	tests := []struct {
+		name     string
+		meta     interfaces.ImageMetadata
+		expected string
+	}{
+		{
+			name:     "capture time",
+			meta:     interfaces.ImageMetadata{CameraID: "camera_1", Sequence: 9, CapturedAt: time.Date(2024, 11, 2, 10, 15, 30, 123456789, time.UTC)},
+			expected: "camera_1/2024-11-02/101530.123456789-9.jpg",
+		},
+		{
+			name:     "capture time in another zone",
+			meta:     interfaces.ImageMetadata{CameraID: "camera_1", Sequence: 1, CapturedAt: time.Date(2024, 11, 2, 23, 30, 0, 0, time.FixedZone("CET", -3600))},
+			expected: "camera_1/2024-11-03/003000.000000000-1.jpg",
+		},
+		{
+			name:     "no capture time",
+			meta:     interfaces.ImageMetadata{CameraID: "camera_1", Sequence: 2},
+			expected: "camera_1/2024-11-03/000001.000000000-2.jpg",
+		},
+		{
+			name:     "unsafe camera ID",
+			meta:     interfaces.ImageMetadata{CameraID: "../stand 12/a", Sequence: 3},
+			expected: "_.._stand_12_a/2024-11-03/000001.000000000-3.jpg",
+		},
+		{
+			name:     "no camera ID",
+			meta:     interfaces.ImageMetadata{Sequence: 4},
+			expected: "_/2024-11-03/000001.000000000-4.jpg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := Key(tt.meta, received)
+			if key != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, key)
+			}
+			if err := checkKey(key); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]interfaces.ImageStore{
+		"file":   fileStore,
+		"memory": NewMemoryStore(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, store)
+		})
+	}
+}
+
+// testStore checks the behavior every ImageStore must share.
+func testStore(t *testing.T, store interfaces.ImageStore) {
+	ctx := context.Background()
+	key := "camera_1/2024-11-02/101530.000000000-9.jpg"
+
+	data := []byte("frame")
+	if err := store.Put(ctx, key, data); err != nil {
+		t.Fatal(err)
+	}
+	data[0] = 'X'
+	if got := read(t, store, key); got != "frame" {
+		t.Errorf("expected the stored frame, got %q", got)
+	}
+
+	if err := store.Put(ctx, key, []byte("frame 2")); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, store, key); got != "frame 2" {
+		t.Errorf("expected the frame to be replaced, got %q", got)
+	}
+
+	for _, bad := range []string{"", "/etc/passwd", "../outside.jpg", "a//b.jpg", "camera_1/.tmp-123"} {
+		if err := store.Put(ctx, bad, data); err == nil {
+			t.Errorf("expected key %q to be refused", bad)
+		}
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open(ctx, key); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist after delete, got %v", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("expected deleting a missing image to succeed, got %v", err)
+	}
+}
+
+func read(t *testing.T, store interfaces.ImageStore, key string) string {
+	t.Helper()
+	r, err := store.Open(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFileStoreLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(context.Background(), "camera_1/2024-11-02/a.jpg", []byte("frame")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "camera_1", "2024-11-02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "a.jpg" {
+		t.Errorf("expected only a.jpg, got %v", entries)
+	}
+}
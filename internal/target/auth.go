@@ -0,0 +1,136 @@
+package target
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/signing"
+)
+
+// DefaultMaxSkew is how far the timestamp of a signed request may be from
+// the target's clock unless changed with SetMaxSkew.
+const DefaultMaxSkew = 5 * time.Minute
+
+// authError is why a delivery was refused: 401 when it could not be
+// authenticated, 403 when it was signed with a valid key but is stale or
+// a replay.
+type authError struct {
+	status int
+	reason string
+}
+
+func unauthorized(reason string) *authError {
+	return &authError{status: http.StatusUnauthorized, reason: reason}
+}
+
+func forbidden(reason string) *authError {
+	return &authError{status: http.StatusForbidden, reason: reason}
+}
+
+// authenticator checks signed deliveries against the active keys.
+type authenticator struct {
+	mu      sync.RWMutex
+	keys    map[string]signing.Key
+	maxSkew time.Duration
+
+	nonceMu sync.Mutex
+	// nonces remembers the nonces of accepted requests while their
+	// timestamps are still within the skew, in order of acceptance
+	nonces map[string]struct{}
+	order  []nonceEntry
+}
+
+type nonceEntry struct {
+	nonce string
+	at    time.Time
+}
+
+func newAuthenticator(keys []signing.Key, maxSkew time.Duration) *authenticator {
+	a := &authenticator{maxSkew: maxSkew, nonces: make(map[string]struct{})}
+	a.setKeys(keys)
+	return a
+}
+
+// setKeys replaces the active keys; with none, deliveries need no signature.
+func (a *authenticator) setKeys(keys []signing.Key) {
+	var byID map[string]signing.Key
+	if len(keys) > 0 {
+		byID = make(map[string]signing.Key, len(keys))
+		for _, k := range keys {
+			byID[k.ID] = k
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = byID
+}
+
+func (a *authenticator) required() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.keys != nil
+}
+
+// key checks what can be checked before the body is read: a known key and
+// a timestamp within the allowed skew.
+func (a *authenticator) key(h http.Header, now time.Time) (signing.Key, *authError) {
+	id := h.Get(signing.HeaderKeyID)
+	if id == "" {
+		return signing.Key{}, unauthorized("missing api key")
+	}
+	a.mu.RLock()
+	key, ok := a.keys[id]
+	a.mu.RUnlock()
+	if !ok {
+		return key, unauthorized("unknown api key")
+	}
+
+	if h.Get(signing.HeaderNonce) == "" {
+		return key, unauthorized("missing signature nonce")
+	}
+	ts, err := strconv.ParseInt(h.Get(signing.HeaderTimestamp), 10, 64)
+	if err != nil {
+		return key, unauthorized("missing or malformed signature timestamp")
+	}
+	if skew := now.Sub(time.Unix(ts, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return key, forbidden("signature timestamp outside the allowed clock skew")
+	}
+	return key, nil
+}
+
+// verify checks the signature over the request, its metadata headers and
+// its body, then that the request was not seen before.
+func (a *authenticator) verify(key signing.Key, signature string, r *http.Request, bodyHash string, now time.Time) *authError {
+	if signature == "" {
+		return unauthorized("missing signature")
+	}
+	if !key.Valid(signature, r.Header, r.Method, r.URL.EscapedPath(), bodyHash) {
+		return unauthorized("invalid signature")
+	}
+	if !a.claimNonce(r.Header.Get(signing.HeaderNonce), now) {
+		return forbidden("replayed request")
+	}
+	return nil
+}
+
+// claimNonce records nonce, reporting false if it was already used. Nonces
+// are kept for twice the skew, after which their timestamps are refused anyway.
+func (a *authenticator) claimNonce(nonce string, now time.Time) bool {
+	a.nonceMu.Lock()
+	defer a.nonceMu.Unlock()
+
+	i := 0
+	for ; i < len(a.order) && now.Sub(a.order[i].at) > 2*a.maxSkew; i++ {
+		delete(a.nonces, a.order[i].nonce)
+	}
+	a.order = a.order[i:]
+
+	if _, ok := a.nonces[nonce]; ok {
+		return false
+	}
+	a.nonces[nonce] = struct{}{}
+	a.order = append(a.order, nonceEntry{nonce: nonce, at: now})
+	return true
+}
@@ -0,0 +1,82 @@
+package target
+
+import (
+	"sync"
+	"time"
+)
+
+// idempotencyWindow is how long a processed delivery is remembered.
+const idempotencyWindow = 15 * time.Minute
+
+type keyState int
+
+const (
+	keyPending keyState = iota + 1
+	keyDone
+)
+
+// idempotencyKeys remembers recent delivery keys so that retries of a frame
+// that was already processed are not processed again.
+type idempotencyKeys struct {
+	mu     sync.Mutex
+	window time.Duration
+	keys   map[string]keyEntry
+	// order lists keys by first use, for expiring them
+	order []keyEntry
+}
+
+type keyEntry struct {
+	key   string
+	state keyState
+	at    time.Time
+}
+
+func newIdempotencyKeys(window time.Duration) *idempotencyKeys {
+	return &idempotencyKeys{window: window, keys: make(map[string]keyEntry)}
+}
+
+// begin claims key for processing. If the key is already pending or done it
+// returns that state instead and the caller must not process the delivery.
+func (k *idempotencyKeys) begin(key string, now time.Time) (keyState, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.expire(now)
+
+	if e, ok := k.keys[key]; ok {
+		return e.state, false
+	}
+	e := keyEntry{key: key, state: keyPending, at: now}
+	k.keys[key] = e
+	k.order = append(k.order, e)
+	return keyPending, true
+}
+
+// finish marks key done, or forgets it when processing failed so that a
+// retry is processed.
+func (k *idempotencyKeys) finish(key string, processed bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	e, ok := k.keys[key]
+	if !ok {
+		return
+	}
+	if !processed {
+		delete(k.keys, key)
+		return
+	}
+	e.state = keyDone
+	k.keys[key] = e
+}
+
+// expire forgets keys older than the window. Callers hold mu.
+func (k *idempotencyKeys) expire(now time.Time) {
+	i := 0
+	for ; i < len(k.order) && now.Sub(k.order[i].at) > k.window; i++ {
+		// A key forgotten after a failure may have been claimed again since
+		if e, ok := k.keys[k.order[i].key]; ok && e.at.Equal(k.order[i].at) {
+			delete(k.keys, k.order[i].key)
+		}
+	}
+	k.order = k.order[i:]
+}
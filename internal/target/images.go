@@ -0,0 +1,143 @@
+package target
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/index"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+const (
+	// DefaultQueryLimit is the page size when a query gives no limit.
+	DefaultQueryLimit = 100
+	MaxQueryLimit     = 1000
+)
+
+// ImagesAPI finds stored images and serves them. Every request must carry
+// the bearer token.
+type ImagesAPI struct {
+	index  *index.Index
+	store  interfaces.ImageStore
+	token  string
+	logger interfaces.Logger
+}
+
+func NewImagesAPI(idx *index.Index, store interfaces.ImageStore, token string, logger interfaces.Logger) *ImagesAPI {
+	return &ImagesAPI{
+		index:  idx,
+		store:  store,
+		token:  token,
+		logger: logger,
+	}
+}
+
+// Register mounts the image endpoints on mux.
+func (a *ImagesAPI) Register(mux *http.ServeMux) {
+	mux.Handle("GET /images", a.auth(a.listImages))
+	mux.Handle("GET /images/{id}", a.auth(a.getImage))
+}
+
+func (a *ImagesAPI) auth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="target-images"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+// listImages answers GET /images?camera=&from=&to=&limit=&cursor= with a
+// page of entries, oldest first.
+func (a *ImagesAPI) listImages(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	page, err := a.index.Query(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func parseQuery(r *http.Request) (index.Query, error) {
+	values := r.URL.Query()
+	q := index.Query{
+		CameraID: values.Get("camera"),
+		Limit:    DefaultQueryLimit,
+		Cursor:   values.Get("cursor"),
+	}
+	for name, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if v := values.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s %q: want an RFC 3339 time", name, v)
+			}
+			*t = parsed
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxQueryLimit {
+			return q, fmt.Errorf("invalid limit %q: want 1 to %d", v, MaxQueryLimit)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// getImage answers GET /images/{id} with the image bytes.
+func (a *ImagesAPI) getImage(w http.ResponseWriter, r *http.Request) {
+	entry, err := a.index.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	body, err := a.store.Open(r.Context(), entry.Key)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(w, http.StatusNotFound, index.ErrNotFound)
+		return
+	}
+	if err != nil {
+		a.logger.Error("Failed to open stored image", "key", entry.Key, logging.KeyError, err)
+		writeError(w, http.StatusInternalServerError, errors.New("failed to open image"))
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", strconv.FormatInt(entry.Size, 10))
+	w.Header().Set(interfaces.HeaderCameraID, entry.CameraID)
+	w.Header().Set(interfaces.HeaderCaptureTime, entry.CapturedAt.Format(time.RFC3339Nano))
+	if entry.Hash != "" {
+		w.Header().Set(interfaces.HeaderContentHash, entry.Hash)
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		a.logger.Warn("Failed to serve stored image", "key", entry.Key, logging.KeyError, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,151 @@
+package target
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akhilesharora/turnaround-collector/internal/index"
+	"github.com/akhilesharora/turnaround-collector/internal/storage"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+const testToken = "s3cret"
+
+func TestImagesAPI(t *testing.T) {
+	logger := &testutils.MockLogger{}
+	idx, err := index.Open(filepath.Join(t.TempDir(), "images.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	store := storage.NewMemoryStore()
+	processor := NewStoreProcessor(store, logger)
+	processor.SetIndex(idx)
+
+	mux := http.NewServeMux()
+	NewImagesAPI(idx, store, testToken, logger).Register(mux)
+	mux.Handle("/", NewServer(logger, processor))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for i, camera := range []string{"camera_1", "camera_2", "camera_1", "camera_1"} {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/image", strings.NewReader(fmt.Sprintf("frame %d", i)))
+		req.Header.Set(interfaces.HeaderCameraID, camera)
+		req.Header.Set(interfaces.HeaderSequence, fmt.Sprint(i))
+		req.Header.Set(interfaces.HeaderCaptureTime, fmt.Sprintf("2024-11-02T10:0%d:00Z", i))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected delivery to succeed, got %d", resp.StatusCode)
+		}
+	}
+
+	get := func(path, token string) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		token          string
+		expectedStatus int
+		expectedSeqs   []uint64
+		expectedMore   bool
+	}{
+		{name: "no token", path: "/images", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", path: "/images", token: "guess", expectedStatus: http.StatusUnauthorized},
+		{name: "all", path: "/images", token: testToken, expectedStatus: http.StatusOK, expectedSeqs: []uint64{0, 1, 2, 3}},
+		{name: "one camera", path: "/images?camera=camera_1", token: testToken, expectedStatus: http.StatusOK, expectedSeqs: []uint64{0, 2, 3}},
+		{name: "time range", path: "/images?from=2024-11-02T10:01:00Z&to=2024-11-02T10:03:00Z", token: testToken,
+			expectedStatus: http.StatusOK, expectedSeqs: []uint64{1, 2}},
+		{name: "first page", path: "/images?limit=2", token: testToken, expectedStatus: http.StatusOK, expectedSeqs: []uint64{0, 1}, expectedMore: true},
+		{name: "bad time", path: "/images?from=yesterday", token: testToken, expectedStatus: http.StatusBadRequest},
+		{name: "bad limit", path: "/images?limit=5000", token: testToken, expectedStatus: http.StatusBadRequest},
+		{name: "bad cursor", path: "/images?cursor=%21", token: testToken, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := get(tt.path, tt.token)
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, resp.StatusCode, body)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var page index.Page
+			if err := json.Unmarshal(body, &page); err != nil {
+				t.Fatal(err)
+			}
+			var seqs []uint64
+			for _, e := range page.Entries {
+				seqs = append(seqs, e.Sequence)
+			}
+			if fmt.Sprint(seqs) != fmt.Sprint(tt.expectedSeqs) {
+				t.Errorf("expected sequences %v, got %v", tt.expectedSeqs, seqs)
+			}
+			if more := page.NextCursor != ""; more != tt.expectedMore {
+				t.Errorf("expected more=%v, got cursor %q", tt.expectedMore, page.NextCursor)
+			}
+		})
+	}
+
+	t.Run("next page", func(t *testing.T) {
+		_, body := get("/images?limit=2", testToken)
+		var first index.Page
+		json.Unmarshal(body, &first)
+		_, body = get("/images?limit=2&cursor="+first.NextCursor, testToken)
+		var second index.Page
+		json.Unmarshal(body, &second)
+		if len(second.Entries) != 2 || second.Entries[0].Sequence != 2 || second.NextCursor != "" {
+			t.Errorf("expected the last two images, got %+v", second)
+		}
+	})
+
+	t.Run("fetch image", func(t *testing.T) {
+		_, body := get("/images?camera=camera_2", testToken)
+		var page index.Page
+		json.Unmarshal(body, &page)
+		if len(page.Entries) != 1 {
+			t.Fatalf("expected one image, got %+v", page)
+		}
+
+		resp, data := get("/images/"+page.Entries[0].ID, testToken)
+		if resp.StatusCode != http.StatusOK || string(data) != "frame 1" {
+			t.Errorf("expected frame 1, got %d %q", resp.StatusCode, data)
+		}
+		if resp.Header.Get(interfaces.HeaderCameraID) != "camera_2" || resp.Header.Get("Content-Type") != "image/jpeg" {
+			t.Errorf("unexpected headers %v", resp.Header)
+		}
+
+		if resp, _ := get("/images/unknown", testToken); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected 404 for an unknown ID, got %d", resp.StatusCode)
+		}
+		store.Delete(context.Background(), page.Entries[0].Key)
+		if resp, _ := get("/images/"+page.Entries[0].ID, testToken); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected 404 for a vanished image, got %d", resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package target
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/bufpool"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+// HeaderFrameID identifies a frame accepted into the work queue.
+const HeaderFrameID = "X-Frame-ID"
+
+// queueRetryAfter is how long clients are asked to wait when the queue is full.
+const queueRetryAfter = time.Second
+
+// workQueue holds accepted frames until a worker processes them.
+type workQueue struct {
+	jobs chan job
+	wg   sync.WaitGroup
+	// mu guards closing jobs against concurrent sends
+	mu     sync.RWMutex
+	closed bool
+}
+
+type job struct {
+	id         string
+	meta       interfaces.ImageMetadata
+	data       []byte
+	acceptedAt time.Time
+}
+
+// SetQueue makes the server accept frames into a queue of size frames and
+// answer 202 Accepted, while workers process them in the background. A
+// full queue is answered with 429 Too Many Requests. It must be called
+// before the server is used, and Shutdown must be called to drain the queue.
+func (s *Server) SetQueue(size, workers int) {
+	s.queue = &workQueue{jobs: make(chan job, size)}
+	for range max(workers, 1) {
+		s.queue.wg.Add(1)
+		go s.work()
+	}
+}
+
+// Shutdown stops accepting frames and waits until the queued ones are
+// processed or ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.queue == nil {
+		return nil
+	}
+	s.queue.mu.Lock()
+	if !s.queue.closed {
+		s.queue.closed = true
+		close(s.queue.jobs)
+	}
+	s.queue.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.queue.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue hands a copy of imageData to the workers, as the caller recycles
+// its buffer once the request is answered.
+func (s *Server) enqueue(w http.ResponseWriter, r *http.Request, meta interfaces.ImageMetadata, imageData []byte) {
+	j := job{
+		id:         newFrameID(),
+		meta:       meta,
+		data:       append(bufpool.Get(len(imageData)), imageData...),
+		acceptedAt: time.Now(),
+	}
+
+	s.queue.mu.RLock()
+	queued := false
+	if !s.queue.closed {
+		select {
+		case s.queue.jobs <- j:
+			queued = true
+		default:
+		}
+	}
+	s.queue.mu.RUnlock()
+
+	if !queued {
+		bufpool.Put(j.data)
+		if meta.IdempotencyKey != "" {
+			s.keys.finish(meta.IdempotencyKey, false)
+		}
+		s.logger.Warn("work queue full",
+			logging.KeyCameraID, meta.CameraID,
+			"sequence", meta.Sequence,
+			"queued", len(s.queue.jobs),
+			"remote_addr", r.RemoteAddr,
+		)
+		w.Header().Set("Retry-After", strconv.Itoa(int(queueRetryAfter.Seconds())))
+		http.Error(w, "Work queue full", http.StatusTooManyRequests)
+		return
+	}
+
+	w.Header().Set(HeaderFrameID, j.id)
+	writeJSON(w, http.StatusAccepted, map[string]string{"frame_id": j.id})
+}
+
+func (s *Server) work() {
+	defer s.queue.wg.Done()
+	for j := range s.queue.jobs {
+		start := time.Now()
+		err := s.processor.Process(j.meta, j.data)
+		bufpool.Put(j.data)
+		if j.meta.IdempotencyKey != "" {
+			s.keys.finish(j.meta.IdempotencyKey, err == nil)
+		}
+		if err != nil {
+			s.logger.Error("error processing queued image",
+				"frame_id", j.id,
+				logging.KeyCameraID, j.meta.CameraID,
+				"sequence", j.meta.Sequence,
+				logging.KeyError, err,
+			)
+			continue
+		}
+		s.logger.Info("successfully processed image",
+			"frame_id", j.id,
+			logging.KeyCameraID, j.meta.CameraID,
+			"sequence", j.meta.Sequence,
+			logging.KeyBytes, len(j.data),
+			"queue_wait_ms", start.Sub(j.acceptedAt).Milliseconds(),
+			logging.KeyDurationMS, time.Since(start).Milliseconds(),
+		)
+	}
+}
+
+func newFrameID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -1,15 +1,34 @@
 package target
 
 import (
-	"io"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/akhilesharora/turnaround-collector/internal/bufpool"
+	"github.com/akhilesharora/turnaround-collector/internal/signing"
 	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
 )
 
+// DefaultMaxImageBytes is the largest image body accepted unless changed
+// with SetMaxImageBytes.
+const DefaultMaxImageBytes = 20 << 20
+
+// HeaderReplayed is set on the response to a delivery that was already
+// processed under the same idempotency key.
+const HeaderReplayed = "Idempotent-Replayed"
+
 type Server struct {
 	logger    interfaces.Logger
 	processor interfaces.ImageProcessor
+	keys      *idempotencyKeys
+	auth      *authenticator
+	queue     *workQueue
+	maxBytes  int64
 }
 
 func NewServer(logger interfaces.Logger, processor interfaces.ImageProcessor) *Server {
@@ -19,15 +38,54 @@ func NewServer(logger interfaces.Logger, processor interfaces.ImageProcessor) *S
 	return &Server{
 		logger:    logger,
 		processor: processor,
+		keys:      newIdempotencyKeys(idempotencyWindow),
+		auth:      newAuthenticator(nil, DefaultMaxSkew),
+		maxBytes:  DefaultMaxImageBytes,
+	}
+}
+
+// SetMaxImageBytes bounds the size of image bodies; larger ones are
+// answered with 413. Zero removes the limit.
+func (s *Server) SetMaxImageBytes(n int64) {
+	s.maxBytes = n
+}
+
+// SetKeys requires every delivery to be signed with one of keys, and can be
+// called again at any time to rotate them. Without keys, deliveries are
+// accepted unsigned.
+func (s *Server) SetKeys(keys []signing.Key) {
+	s.auth.setKeys(keys)
+}
+
+// SetMaxSkew bounds how far the timestamp of a signed delivery may be from
+// the server's clock. It must be called before the server is used.
+func (s *Server) SetMaxSkew(d time.Duration) {
+	s.auth.maxSkew = d
+}
+
+// Ready reports whether the server can accept images. Processors that need
+// to warm up first can implement Ready() error themselves.
+func (s *Server) Ready() error {
+	if s.processor == nil {
+		return errors.New("processor not initialized")
+	}
+	if r, ok := s.processor.(interface{ Ready() error }); ok {
+		return r.Ready()
 	}
+	return nil
 }
 
 type defaultProcessor struct {
 	logger interfaces.Logger
 }
 
-func (p *defaultProcessor) Process(imageData []byte) error {
-	p.logger.Printf("processed image of size %d bytes", len(imageData))
+func (p *defaultProcessor) Process(meta interfaces.ImageMetadata, imageData []byte) error {
+	p.logger.Info("processed image",
+		logging.KeyCameraID, meta.CameraID,
+		"sequence", meta.Sequence,
+		logging.KeyBytes, len(imageData),
+		"captured_at", meta.CapturedAt,
+	)
 	return nil
 }
 
@@ -42,19 +100,143 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	imageData, err := io.ReadAll(r.Body)
+	start := time.Now()
+	meta, err := interfaces.MetadataFromHeaders(r.Header)
+	if err != nil {
+		s.logger.Warn("invalid image metadata", "remote_addr", r.RemoteAddr, logging.KeyError, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Unknown keys and stale timestamps are refused before reading the body
+	var key signing.Key
+	authRequired := s.auth.required()
+	if authRequired {
+		var authErr *authError
+		if key, authErr = s.auth.key(r.Header, start); authErr != nil {
+			s.rejectUnauthenticated(w, r, meta, authErr)
+			return
+		}
+	}
+
+	if s.maxBytes > 0 {
+		if r.ContentLength > s.maxBytes {
+			s.rejectTooLarge(w, r, meta)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBytes)
+	}
+
+	imageData, err := bufpool.ReadAll(r.Body, r.ContentLength)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.rejectTooLarge(w, r, meta)
+		return
+	}
 	if err != nil {
-		s.logger.Printf("error reading request body: %v", err)
+		s.logger.Error("error reading request body", logging.KeyCameraID, meta.CameraID, logging.KeyError, err)
 		http.Error(w, "Failed to read image", http.StatusBadRequest)
 		return
 	}
+	defer bufpool.Put(imageData)
+
+	hash := sha256.Sum256(imageData)
+	bodyHash := hex.EncodeToString(hash[:])
+
+	// Streamed images only know their hash once sent, so it and the
+	// signature come as trailers
+	if authRequired {
+		signature := r.Header.Get(signing.HeaderSignature)
+		if signature == "" {
+			signature = r.Trailer.Get(signing.HeaderSignature)
+		}
+		if authErr := s.auth.verify(key, signature, r, bodyHash, start); authErr != nil {
+			s.rejectUnauthenticated(w, r, meta, authErr)
+			return
+		}
+	}
+
+	if meta.ContentHash == "" {
+		meta.ContentHash = r.Trailer.Get(interfaces.HeaderContentHash)
+	}
+	if meta.ContentHash != "" {
+		if !strings.EqualFold(meta.ContentHash, bodyHash) {
+			s.logger.Warn("content hash mismatch",
+				logging.KeyCameraID, meta.CameraID,
+				"sequence", meta.Sequence,
+				"remote_addr", r.RemoteAddr,
+			)
+			http.Error(w, "Content hash mismatch", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Retries reuse the key of the original delivery; process it only once
+	if meta.IdempotencyKey != "" {
+		state, claimed := s.keys.begin(meta.IdempotencyKey, time.Now())
+		if !claimed {
+			s.logger.Info("ignored repeated delivery",
+				logging.KeyCameraID, meta.CameraID,
+				"sequence", meta.Sequence,
+				"idempotency_key", meta.IdempotencyKey,
+			)
+			if state == keyPending {
+				if s.queue != nil {
+					// Already accepted into the queue
+					w.Header().Set(HeaderReplayed, "true")
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+				http.Error(w, "Delivery already in progress", http.StatusConflict)
+				return
+			}
+			w.Header().Set(HeaderReplayed, "true")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	if s.queue != nil {
+		s.enqueue(w, r, meta, imageData)
+		return
+	}
 
-	if err := s.processor.Process(imageData); err != nil {
-		s.logger.Printf("error processing image: %v", err)
+	err = s.processor.Process(meta, imageData)
+	if meta.IdempotencyKey != "" {
+		s.keys.finish(meta.IdempotencyKey, err == nil)
+	}
+	if err != nil {
+		s.logger.Error("error processing image", logging.KeyCameraID, meta.CameraID, logging.KeyError, err)
 		http.Error(w, "Failed to process image", http.StatusInternalServerError)
 		return
 	}
 
-	s.logger.Printf("successfully processed image from %s", r.RemoteAddr)
+	s.logger.Info("successfully processed image",
+		logging.KeyCameraID, meta.CameraID,
+		"sequence", meta.Sequence,
+		logging.KeyBytes, len(imageData),
+		logging.KeyDurationMS, time.Since(start).Milliseconds(),
+		"remote_addr", r.RemoteAddr,
+	)
 	w.WriteHeader(http.StatusOK)
 }
+
+func (s *Server) rejectUnauthenticated(w http.ResponseWriter, r *http.Request, meta interfaces.ImageMetadata, authErr *authError) {
+	s.logger.Warn("rejected image delivery",
+		"reason", authErr.reason,
+		"key_id", r.Header.Get(signing.HeaderKeyID),
+		logging.KeyCameraID, meta.CameraID,
+		"remote_addr", r.RemoteAddr,
+	)
+	http.Error(w, http.StatusText(authErr.status), authErr.status)
+}
+
+func (s *Server) rejectTooLarge(w http.ResponseWriter, r *http.Request, meta interfaces.ImageMetadata) {
+	s.logger.Warn("image too large",
+		logging.KeyCameraID, meta.CameraID,
+		"sequence", meta.Sequence,
+		"max_bytes", s.maxBytes,
+		"remote_addr", r.RemoteAddr,
+	)
+	http.Error(w, "Image too large", http.StatusRequestEntityTooLarge)
+}
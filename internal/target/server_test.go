@@ -2,22 +2,35 @@ package target
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/akhilesharora/turnaround-collector/internal/signing"
+	"github.com/akhilesharora/turnaround-collector/internal/storage"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
 	"github.com/akhilesharora/turnaround-collector/pkg/testutils"
 )
 
+// SHA-256 of "test image"
+const testImageHash = "1187327c6d0f0b0b19b33ab211a549023aa9a41f359c6d0a827d7bd99f8d5994"
+
 // Mocks
 type mockProcessor struct {
-	processFunc func([]byte) error
+	processFunc func(interfaces.ImageMetadata, []byte) error
 }
 
-func (m *mockProcessor) Process(imageData []byte) error {
-	return m.processFunc(imageData)
+func (m *mockProcessor) Process(meta interfaces.ImageMetadata, imageData []byte) error {
+	return m.processFunc(meta, imageData)
 }
 
 func TestTargetServer(t *testing.T) {
@@ -25,9 +38,11 @@ func TestTargetServer(t *testing.T) {
 		name           string
 		method         string
 		path           string
+		headers        map[string]string
 		processError   error
 		expectedStatus int
 		checkLogs      func(t *testing.T, logs []string)
+		checkMeta      func(t *testing.T, meta interfaces.ImageMetadata)
 	}{
 		{
 			name:           "valid request",
@@ -79,13 +94,54 @@ func TestTargetServer(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:   "metadata passed to processor",
+			method: http.MethodPost,
+			path:   "/image",
+			headers: map[string]string{
+				"X-Camera-ID":      "stand_4_nose",
+				"X-Capture-Time":   "2024-11-02T10:15:30.5Z",
+				"X-Fetch-Latency":  "35ms",
+				"X-Sequence":       "42",
+				"X-Content-SHA256": testImageHash,
+			},
+			expectedStatus: http.StatusOK,
+			checkMeta: func(t *testing.T, meta interfaces.ImageMetadata) {
+				expected := interfaces.ImageMetadata{
+					CameraID:     "stand_4_nose",
+					CapturedAt:   time.Date(2024, 11, 2, 10, 15, 30, 5e8, time.UTC),
+					FetchLatency: 35 * time.Millisecond,
+					Sequence:     42,
+					ContentHash:  testImageHash,
+				}
+				if meta != expected {
+					t.Errorf("expected metadata %+v, got %+v", expected, meta)
+				}
+			},
+		},
+		{
+			name:           "content hash mismatch",
+			method:         http.MethodPost,
+			path:           "/image",
+			headers:        map[string]string{"X-Content-SHA256": strings.Repeat("0", 64)},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "malformed sequence",
+			method:         http.MethodPost,
+			path:           "/image",
+			headers:        map[string]string{"X-Sequence": "first"},
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			logger := &testutils.MockLogger{}
+			var gotMeta interfaces.ImageMetadata
 			processor := &mockProcessor{
-				processFunc: func([]byte) error {
+				processFunc: func(meta interfaces.ImageMetadata, _ []byte) error {
+					gotMeta = meta
 					return tt.processError
 				},
 			}
@@ -94,6 +150,9 @@ func TestTargetServer(t *testing.T) {
 
 			body := bytes.NewReader([]byte("test image"))
 			req := httptest.NewRequest(tt.method, tt.path, body)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
 			w := httptest.NewRecorder()
 
 			server.ServeHTTP(w, req)
@@ -106,9 +165,399 @@ func TestTargetServer(t *testing.T) {
 				tt.checkLogs(t, logger.Logs)
 			}
 
+			if tt.checkMeta != nil {
+				tt.checkMeta(t, gotMeta)
+			}
+
 			if t.Failed() {
 				t.Logf("Logs:\n%s", strings.Join(logger.Logs, "\n"))
 			}
 		})
 	}
 }
+
+type warmingProcessor struct {
+	mockProcessor
+	err error
+}
+
+func (p *warmingProcessor) Ready() error {
+	return p.err
+}
+
+func TestTargetServerReady(t *testing.T) {
+	logger := &testutils.MockLogger{}
+
+	if err := NewServer(logger, nil).Ready(); err != nil {
+		t.Errorf("expected default processor to be ready, got %v", err)
+	}
+
+	warming := &warmingProcessor{err: errors.New("opening storage")}
+	server := NewServer(logger, warming)
+	if err := server.Ready(); err == nil {
+		t.Error("expected server to report processor not ready")
+	}
+
+	warming.err = nil
+	if err := server.Ready(); err != nil {
+		t.Errorf("expected server to be ready, got %v", err)
+	}
+}
+
+func TestTargetServerIdempotency(t *testing.T) {
+	logger := &testutils.MockLogger{}
+	var processed int
+	failNext := false
+	server := NewServer(logger, &mockProcessor{
+		processFunc: func(interfaces.ImageMetadata, []byte) error {
+			if failNext {
+				failNext = false
+				return errors.New("disk full")
+			}
+			processed++
+			return nil
+		},
+	})
+
+	deliver := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/image", strings.NewReader("test image"))
+		req.Header.Set(interfaces.HeaderIdempotencyKey, key)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name              string
+		key               string
+		fail              bool
+		expectedStatus    int
+		expectedReplayed  bool
+		expectedProcessed int
+	}{
+		{name: "first delivery", key: "camera_1-1", expectedStatus: http.StatusOK, expectedProcessed: 1},
+		{name: "retry", key: "camera_1-1", expectedStatus: http.StatusOK, expectedReplayed: true, expectedProcessed: 1},
+		{name: "next frame", key: "camera_1-2", expectedStatus: http.StatusOK, expectedProcessed: 2},
+		{name: "failed delivery", key: "camera_1-3", fail: true, expectedStatus: http.StatusInternalServerError, expectedProcessed: 2},
+		{name: "retry after failure", key: "camera_1-3", expectedStatus: http.StatusOK, expectedProcessed: 3},
+		{name: "no key", expectedStatus: http.StatusOK, expectedProcessed: 4},
+		{name: "no key again", expectedStatus: http.StatusOK, expectedProcessed: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failNext = tt.fail
+			w := deliver(tt.key)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if replayed := w.Header().Get(HeaderReplayed) == "true"; replayed != tt.expectedReplayed {
+				t.Errorf("expected replayed=%v, got %v", tt.expectedReplayed, replayed)
+			}
+			if processed != tt.expectedProcessed {
+				t.Errorf("expected %d processed deliveries, got %d", tt.expectedProcessed, processed)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	keys := newIdempotencyKeys(time.Minute)
+	now := time.Now()
+
+	if _, claimed := keys.begin("a", now); !claimed {
+		t.Fatal("expected a new key to be claimed")
+	}
+	if state, claimed := keys.begin("a", now); claimed || state != keyPending {
+		t.Errorf("expected a key being processed to be pending, got %v, %v", state, claimed)
+	}
+	keys.finish("a", true)
+	if state, claimed := keys.begin("a", now.Add(30*time.Second)); claimed || state != keyDone {
+		t.Errorf("expected a processed key to be done, got %v, %v", state, claimed)
+	}
+	if _, claimed := keys.begin("a", now.Add(2*time.Minute)); !claimed {
+		t.Error("expected the key to expire after the window")
+	}
+}
+
+func TestTargetServerBodyLimits(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxBytes       int64
+		chunked        bool
+		trailerHash    string
+		expectedStatus int
+	}{
+		{name: "within limit", maxBytes: 10, expectedStatus: http.StatusOK},
+		{name: "declared length too large", maxBytes: 9, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "chunked body too large", maxBytes: 9, chunked: true, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "no limit", maxBytes: 0, chunked: true, expectedStatus: http.StatusOK},
+		{name: "hash trailer", chunked: true, trailerHash: testImageHash, expectedStatus: http.StatusOK},
+		{name: "hash trailer mismatch", chunked: true, trailerHash: strings.Repeat("0", 64), expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(&testutils.MockLogger{}, &mockProcessor{
+				processFunc: func(interfaces.ImageMetadata, []byte) error { return nil },
+			})
+			server.SetMaxImageBytes(tt.maxBytes)
+
+			req := httptest.NewRequest(http.MethodPost, "/image", strings.NewReader("test image"))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			if tt.trailerHash != "" {
+				req.Trailer = http.Header{}
+				req.Trailer.Set(interfaces.HeaderContentHash, tt.trailerHash)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestTargetServerSignatures(t *testing.T) {
+	current := signing.Key{ID: "collector-2", Client: "collector", Secret: "new secret"}
+	previous := signing.Key{ID: "collector-1", Client: "collector", Secret: "old secret"}
+
+	tests := []struct {
+		name           string
+		keys           []signing.Key
+		signWith       *signing.Key
+		skew           time.Duration
+		bodyHash       string
+		trailer        bool
+		replay         bool
+		tamper         string // metadata header changed after signing
+		expectedStatus int
+		expectedReason string
+	}{
+		{name: "no keys configured", expectedStatus: http.StatusOK},
+		{name: "valid signature", keys: []signing.Key{current}, signWith: &current, expectedStatus: http.StatusOK},
+		{name: "previous key during rotation", keys: []signing.Key{current, previous}, signWith: &previous, expectedStatus: http.StatusOK},
+		{name: "unsigned", keys: []signing.Key{current}, expectedStatus: http.StatusUnauthorized, expectedReason: "missing api key"},
+		{name: "retired key", keys: []signing.Key{current}, signWith: &previous, expectedStatus: http.StatusUnauthorized, expectedReason: "unknown api key"},
+		{name: "tampered body", keys: []signing.Key{current}, signWith: &current, bodyHash: strings.Repeat("0", 64),
+			expectedStatus: http.StatusUnauthorized, expectedReason: "invalid signature"},
+		{name: "tampered camera", keys: []signing.Key{current}, signWith: &current, tamper: interfaces.HeaderCameraID,
+			expectedStatus: http.StatusUnauthorized, expectedReason: "invalid signature"},
+		{name: "tampered capture time", keys: []signing.Key{current}, signWith: &current, tamper: interfaces.HeaderCaptureTime,
+			expectedStatus: http.StatusUnauthorized, expectedReason: "invalid signature"},
+		{name: "clock skew", keys: []signing.Key{current}, signWith: &current, skew: -10 * time.Minute,
+			expectedStatus: http.StatusForbidden, expectedReason: "clock skew"},
+		{name: "replay", keys: []signing.Key{current}, signWith: &current, replay: true,
+			expectedStatus: http.StatusForbidden, expectedReason: "replayed request"},
+		{name: "signature trailer", keys: []signing.Key{current}, signWith: &current, trailer: true, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &testutils.MockLogger{}
+			server := NewServer(logger, &mockProcessor{
+				processFunc: func(interfaces.ImageMetadata, []byte) error { return nil },
+			})
+			server.SetKeys(tt.keys)
+
+			header := http.Header{}
+			interfaces.ImageMetadata{
+				CameraID:   "camera_1",
+				CapturedAt: time.Date(2024, 11, 2, 10, 15, 30, 0, time.UTC),
+				Sequence:   1,
+			}.SetHeaders(header)
+			trailer := http.Header{}
+			if tt.signWith != nil {
+				bodyHash := tt.bodyHash
+				if bodyHash == "" {
+					bodyHash = testImageHash
+				}
+				tt.signWith.Sign(header, http.MethodPost, "/image", bodyHash, time.Now().Add(tt.skew))
+				if tt.tamper != "" {
+					header.Set(tt.tamper, "2024-11-03T10:15:30Z")
+				}
+				if tt.trailer {
+					trailer.Set(signing.HeaderSignature, header.Get(signing.HeaderSignature))
+					header.Del(signing.HeaderSignature)
+				}
+			}
+			deliver := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/image", strings.NewReader("test image"))
+				req.Header = header.Clone()
+				if tt.trailer {
+					req.ContentLength = -1
+					req.Trailer = trailer
+				}
+				w := httptest.NewRecorder()
+				server.ServeHTTP(w, req)
+				return w
+			}
+
+			w := deliver()
+			if tt.replay {
+				if w.Code != http.StatusOK {
+					t.Fatalf("expected the first delivery to succeed, got %d", w.Code)
+				}
+				w = deliver()
+			}
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body)
+			}
+			if tt.expectedReason != "" {
+				found := false
+				for _, log := range logger.Logs {
+					if found = strings.Contains(log, "rejected image delivery") && strings.Contains(log, tt.expectedReason); found {
+						break
+					}
+				}
+				if !found {
+					t.Errorf("expected a rejection logged with reason %q, got %v", tt.expectedReason, logger.Logs)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreProcessor(t *testing.T) {
+	store := storage.NewMemoryStore()
+	server := NewServer(&testutils.MockLogger{}, NewStoreProcessor(store, &testutils.MockLogger{}))
+
+	req := httptest.NewRequest(http.MethodPost, "/image", strings.NewReader("test image"))
+	req.Header.Set(interfaces.HeaderCameraID, "camera_1")
+	req.Header.Set(interfaces.HeaderSequence, "9")
+	req.Header.Set(interfaces.HeaderCaptureTime, "2024-11-02T10:15:30.123456789Z")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	r, err := store.Open(context.Background(), "camera_1/2024-11-02/101530.123456789-9.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, _ := io.ReadAll(r); string(data) != "test image" {
+		t.Errorf("expected the delivered image to be stored, got %q", data)
+	}
+}
+
+func TestTargetServerQueue(t *testing.T) {
+	logger := &testutils.MockLogger{}
+	started := make(chan string, 3)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var processed []string
+	server := NewServer(logger, &mockProcessor{
+		processFunc: func(meta interfaces.ImageMetadata, imageData []byte) error {
+			started <- meta.CameraID
+			<-release
+			mu.Lock()
+			defer mu.Unlock()
+			processed = append(processed, string(imageData))
+			return nil
+		},
+	})
+	server.SetQueue(1, 1)
+
+	deliver := func(camera, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/image", strings.NewReader("image of "+camera))
+		req.Header.Set(interfaces.HeaderCameraID, camera)
+		if key != "" {
+			req.Header.Set(interfaces.HeaderIdempotencyKey, key)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	// The worker takes the first frame and blocks on it, the second waits in the queue
+	if w := deliver("camera_1", ""); w.Code != http.StatusAccepted || w.Header().Get(HeaderFrameID) == "" {
+		t.Fatalf("expected 202 with a frame ID, got %d %v", w.Code, w.Header())
+	}
+	<-started
+	if w := deliver("camera_2", "camera_2-1"); w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", w.Code)
+	}
+
+	tests := []struct {
+		name               string
+		camera             string
+		key                string
+		expectedStatus     int
+		expectedRetryAfter string
+		expectedReplayed   bool
+	}{
+		{name: "queue full", camera: "camera_3", expectedStatus: http.StatusTooManyRequests, expectedRetryAfter: "1"},
+		{name: "retry of a queued frame", camera: "camera_2", key: "camera_2-1", expectedStatus: http.StatusAccepted, expectedReplayed: true},
+		{name: "refused frame retried", camera: "camera_4", key: "camera_4-1", expectedStatus: http.StatusTooManyRequests, expectedRetryAfter: "1"},
+		{name: "refused frame retried again", camera: "camera_4", key: "camera_4-1", expectedStatus: http.StatusTooManyRequests, expectedRetryAfter: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := deliver(tt.camera, tt.key)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.expectedRetryAfter {
+				t.Errorf("expected Retry-After %q, got %q", tt.expectedRetryAfter, got)
+			}
+			if replayed := w.Header().Get(HeaderReplayed) == "true"; replayed != tt.expectedReplayed {
+				t.Errorf("expected replayed=%v, got %v", tt.expectedReplayed, replayed)
+			}
+		})
+	}
+
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(processed) != "[image of camera_1 image of camera_2]" {
+		t.Errorf("expected the two accepted frames to be processed, got %v", processed)
+	}
+	if w := deliver("camera_5", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected frames to be refused after shutdown, got %d", w.Code)
+	}
+}
+
+// BenchmarkServerImage posts a frame to the handler. "unpooled" reads the
+// same body into a fresh buffer, as the handler did before, for comparison.
+func BenchmarkServerImage(b *testing.B) {
+	frame := bytes.Repeat([]byte{0xAB}, 200<<10)
+	logger, _ := logging.New(io.Discard, "text", slog.LevelError)
+	server := NewServer(logger, &mockProcessor{
+		processFunc: func(meta interfaces.ImageMetadata, imageData []byte) error { return nil },
+	})
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/image", bytes.NewReader(frame))
+		req.Header.Set(interfaces.HeaderCameraID, "camera_1")
+		return req
+	}
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, newRequest())
+			if rec.Code != http.StatusOK {
+				b.Fatalf("expected status 200, got %d", rec.Code)
+			}
+		}
+	})
+
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			req := newRequest()
+			if _, err := io.ReadAll(http.MaxBytesReader(httptest.NewRecorder(), req.Body, DefaultMaxImageBytes)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package target
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/internal/index"
+	"github.com/akhilesharora/turnaround-collector/internal/storage"
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+// StoreProcessor keeps every received image in an ImageStore, partitioned
+// by camera and capture date.
+type StoreProcessor struct {
+	store  interfaces.ImageStore
+	index  *index.Index
+	logger interfaces.Logger
+}
+
+func NewStoreProcessor(store interfaces.ImageStore, logger interfaces.Logger) *StoreProcessor {
+	return &StoreProcessor{store: store, logger: logger}
+}
+
+// SetIndex records every stored image in idx. It must be called before the
+// processor is used.
+func (p *StoreProcessor) SetIndex(idx *index.Index) {
+	p.index = idx
+}
+
+func (p *StoreProcessor) Process(meta interfaces.ImageMetadata, imageData []byte) error {
+	now := time.Now()
+	key := storage.Key(meta, now)
+	if err := p.store.Put(context.Background(), key, imageData); err != nil {
+		return fmt.Errorf("store image: %w", err)
+	}
+	if p.index != nil {
+		// A failed entry fails the delivery; its retry stores the image
+		// under the same key again
+		if err := p.index.Add(newEntry(meta, key, imageData, now)); err != nil {
+			return fmt.Errorf("index image: %w", err)
+		}
+	}
+	p.logger.Info("stored image",
+		logging.KeyCameraID, meta.CameraID,
+		"sequence", meta.Sequence,
+		logging.KeyBytes, len(imageData),
+		"key", key,
+	)
+	return nil
+}
+
+func newEntry(meta interfaces.ImageMetadata, key string, imageData []byte, receivedAt time.Time) index.Entry {
+	hash := strings.ToLower(meta.ContentHash)
+	if hash == "" {
+		sum := sha256.Sum256(imageData)
+		hash = hex.EncodeToString(sum[:])
+	}
+	capturedAt := meta.CapturedAt
+	if capturedAt.IsZero() {
+		capturedAt = receivedAt
+	}
+	return index.Entry{
+		ID:         index.ID(key),
+		CameraID:   meta.CameraID,
+		CapturedAt: capturedAt,
+		ReceivedAt: receivedAt,
+		Sequence:   meta.Sequence,
+		Size:       int64(len(imageData)),
+		Hash:       hash,
+		Key:        key,
+	}
+}
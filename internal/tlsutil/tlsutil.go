@@ -0,0 +1,186 @@
+// Package tlsutil loads certificates for the services' TLS listeners and
+// clients, and reloads them when they are rotated on disk.
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
+)
+
+// DefaultReloadInterval is how often Watch checks certificates for changes.
+const DefaultReloadInterval = 30 * time.Second
+
+// Keypair is a certificate and key loaded from files. Handshakes always use
+// the most recently loaded pair, so a rotated certificate takes effect for
+// new connections without a restart.
+type Keypair struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func NewKeypair(certFile, keyFile string) (*Keypair, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("cert_file and key_file must be set together")
+	}
+	k := &Keypair{certFile: certFile, keyFile: keyFile}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload loads the pair from its files again. On error the current
+// certificate is kept.
+func (k *Keypair) Reload() error {
+	certMod, keyMod := modTime(k.certFile), modTime(k.keyFile)
+	cert, err := tls.LoadX509KeyPair(k.certFile, k.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.cert = &cert
+	k.certMod, k.keyMod = certMod, keyMod
+	return nil
+}
+
+// changed reports whether either file was modified since the last load.
+func (k *Keypair) changed() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return !modTime(k.certFile).Equal(k.certMod) || !modTime(k.keyFile).Equal(k.keyMod)
+}
+
+func (k *Keypair) Certificate() *tls.Certificate {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.cert
+}
+
+// GetCertificate serves the pair from a tls.Config on the server side.
+func (k *Keypair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return k.Certificate(), nil
+}
+
+// GetClientCertificate presents the pair from a tls.Config on the client side.
+func (k *Keypair) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return k.Certificate(), nil
+}
+
+// Watch reloads the pair whenever its files change, checking every interval
+// until ctx is done. Certificate and key are often replaced one after the
+// other, so a failed reload is retried on the next change.
+func (k *Keypair) Watch(ctx context.Context, interval time.Duration, logger interfaces.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !k.changed() {
+			continue
+		}
+		if err := k.Reload(); err != nil {
+			logger.Error("Failed to reload TLS certificate; keeping the current one",
+				"cert_file", k.certFile,
+				logging.KeyError, err,
+			)
+			continue
+		}
+		logger.Info("Reloaded TLS certificate", "cert_file", k.certFile, "not_after", k.notAfter())
+	}
+}
+
+func (k *Keypair) notAfter() time.Time {
+	if leaf := k.Certificate().Leaf; leaf != nil {
+		return leaf.NotAfter
+	}
+	return time.Time{}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// LoadCertPool reads a PEM bundle, on top of the system roots if system is set.
+func LoadCertPool(file string, system bool) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if system {
+		if roots, err := x509.SystemCertPool(); err == nil {
+			pool = roots
+		}
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s contains no PEM certificates", file)
+	}
+	return pool, nil
+}
+
+// ServerConfig returns a listener configuration serving keypair. With a
+// clientCAFile, clients must present a certificate signed by one of its CAs.
+func ServerConfig(keypair *Keypair, clientCAFile string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: keypair.GetCertificate,
+	}
+	if clientCAFile != "" {
+		pool, err := LoadCertPool(clientCAFile, false)
+		if err != nil {
+			return nil, fmt.Errorf("client CA: %w", err)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// ServerFromEnv builds a listener configuration from TLS_CERT_FILE,
+// TLS_KEY_FILE and TLS_CLIENT_CA_FILE. It returns nil when TLS is not
+// configured, in which case the server speaks plain HTTP.
+func ServerFromEnv() (*tls.Config, *Keypair, error) {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	clientCAFile := os.Getenv("TLS_CLIENT_CA_FILE")
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, nil, errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+		return nil, nil, nil
+	}
+
+	keypair, err := NewKeypair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err := ServerConfig(keypair, clientCAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, keypair, nil
+}
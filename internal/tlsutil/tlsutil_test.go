@@ -0,0 +1,247 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/testutils"
+)
+
+// testCert is a certificate generated for a test, signed by parent or
+// self-signed when parent is nil.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key}
+}
+
+// write stores the certificate and key as PEM files in dir.
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeypairReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	certFile, keyFile := newTestCert(t, "first", ca).write(t, dir, "server")
+
+	keypair, err := NewKeypair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := keypair.Certificate().Leaf.Subject.CommonName; got != "first" {
+		t.Fatalf("expected the first certificate, got %q", got)
+	}
+
+	logger := &testutils.MockLogger{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		keypair.Watch(ctx, 10*time.Millisecond, logger)
+	}()
+
+	// Rotate the pair; the watcher picks it up
+	rotated := newTestCert(t, "second", ca)
+	later := time.Now().Add(time.Minute)
+	rotated.write(t, dir, "server")
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	waitFor(t, func() bool { return keypair.Certificate().Leaf.Subject.CommonName == "second" })
+
+	// A broken rotation keeps the current certificate
+	writeFile(t, keyFile, []byte("not a key"))
+	even := later.Add(time.Minute)
+	os.Chtimes(keyFile, even, even)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+	if got := keypair.Certificate().Leaf.Subject.CommonName; got != "second" {
+		t.Errorf("expected the second certificate to be kept, got %q", got)
+	}
+	logs := strings.Join(logger.Logs, "\n")
+	if !strings.Contains(logs, "Reloaded TLS certificate") || !strings.Contains(logs, "Failed to reload TLS certificate") {
+		t.Errorf("expected the reload and the failed reload to be logged, got:\n%s", logs)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServerConfigMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCert, serverKey := newTestCert(t, "target", ca).write(t, dir, "server")
+	clientCert, clientKey := newTestCert(t, "collector", ca).write(t, dir, "client")
+	strangerCert, strangerKey := newTestCert(t, "stranger", newTestCert(t, "other ca", nil)).write(t, dir, "stranger")
+
+	keypair, err := NewKeypair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig, err := ServerConfig(keypair, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	// StartTLS would add its own certificate; serve the configuration as is
+	server.Listener = tls.NewListener(server.Listener, serverConfig)
+	server.Start()
+	defer server.Close()
+	serverURL := "https://" + server.Listener.Addr().String()
+
+	roots, err := LoadCertPool(caFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		certFile  string
+		keyFile   string
+		expectErr bool
+	}{
+		{name: "trusted client", certFile: clientCert, keyFile: clientKey},
+		{name: "no client certificate", expectErr: true},
+		{name: "untrusted client", certFile: strangerCert, keyFile: strangerKey, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConfig := &tls.Config{RootCAs: roots}
+			if tt.certFile != "" {
+				clientKeypair, err := NewKeypair(tt.certFile, tt.keyFile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				clientConfig.GetClientCertificate = clientKeypair.GetClientCertificate
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+
+			resp, err := client.Get(serverURL)
+			if tt.expectErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("expected the handshake to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			peer, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK || string(peer) != "collector" {
+				t.Errorf("expected the collector certificate to be seen, got %d %q", resp.StatusCode, peer)
+			}
+		})
+	}
+}
+
+func TestServerFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := newTestCert(t, "camera", nil).write(t, dir, "camera")
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		expectTLS bool
+		expectErr bool
+	}{
+		{name: "plain HTTP", env: map[string]string{}},
+		{name: "TLS", env: map[string]string{"TLS_CERT_FILE": certFile, "TLS_KEY_FILE": keyFile}, expectTLS: true},
+		{name: "key missing", env: map[string]string{"TLS_CERT_FILE": certFile}, expectErr: true},
+		{name: "client CA without certificate", env: map[string]string{"TLS_CLIENT_CA_FILE": certFile}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_CLIENT_CA_FILE"} {
+				t.Setenv(key, tt.env[key])
+			}
+			cfg, keypair, err := ServerFromEnv()
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error %v, got %v", tt.expectErr, err)
+			}
+			if (cfg != nil) != tt.expectTLS || (keypair != nil) != tt.expectTLS {
+				t.Errorf("expected TLS %v, got config %v", tt.expectTLS, cfg != nil)
+			}
+		})
+	}
+}
@@ -2,18 +2,41 @@ package interfaces
 
 import (
 	"context"
+	"io"
 )
 
 // Collector interfaces
+
+// ImageFetcher hands the returned image over to the caller, which may
+// recycle its buffer once done, so it must not be retained.
 type ImageFetcher interface {
-	FetchImage(ctx context.Context, cameraID int) ([]byte, error)
+	FetchImage(ctx context.Context, cameraID string) ([]byte, error)
 }
 
+// ImageSender must not retain imageData after SendImage returned.
 type ImageSender interface {
-	SendImage(ctx context.Context, imageData []byte) error
+	SendImage(ctx context.Context, meta ImageMetadata, imageData []byte) error
+}
+
+// ImageStreamer copies a frame from a camera to the target without holding
+// it in memory, returning the number of bytes copied.
+type ImageStreamer interface {
+	StreamImage(ctx context.Context, meta ImageMetadata) (int64, error)
 }
 
 // Target server interfaces
+
+// ImageProcessor must not retain imageData after Process returned.
 type ImageProcessor interface {
-	Process(imageData []byte) error
+	Process(meta ImageMetadata, imageData []byte) error
+}
+
+// ImageStore keeps images under slash-separated keys such as
+// "camera_1/2024-11-02/101530.000000000-9.jpg". Put must not retain data
+// after returning. Open returns an error wrapping fs.ErrNotExist for
+// unknown keys, while deleting one is not an error.
+type ImageStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
 }
@@ -1,5 +1,15 @@
 package interfaces
 
+// Logger is a leveled, structured logger. The arguments after msg are
+// alternating keys and values, as with log/slog; *slog.Logger satisfies it.
 type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// PrintfLogger is the classic printf-style logger, e.g. *log.Logger.
+type PrintfLogger interface {
 	Printf(format string, v ...interface{})
 }
@@ -0,0 +1,107 @@
+package interfaces
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers carrying ImageMetadata from the collector to the target.
+const (
+	HeaderCameraID     = "X-Camera-ID"
+	HeaderCaptureTime  = "X-Capture-Time"
+	HeaderFetchLatency = "X-Fetch-Latency"
+	HeaderSequence     = "X-Sequence"
+	HeaderContentHash  = "X-Content-SHA256"
+	HeaderRequestTime  = "X-Requested-Time"
+	HeaderFrameSetID   = "X-Frame-Set-ID"
+	HeaderDuplicateOf  = "X-Duplicate-Of"
+	// HeaderIdempotencyKey is the same for every attempt to deliver a frame.
+	HeaderIdempotencyKey = "Idempotency-Key"
+)
+
+// ImageMetadata describes where and when a frame was captured.
+type ImageMetadata struct {
+	CameraID string `json:"camera_id"`
+	// CapturedAt is when the snapshot was requested from the camera.
+	CapturedAt   time.Time     `json:"captured_at"`
+	FetchLatency time.Duration `json:"fetch_latency"`
+	// Sequence counts frames per camera since the collector started.
+	Sequence uint64 `json:"sequence"`
+	// ContentHash is the hex-encoded SHA-256 of the image bytes.
+	ContentHash string `json:"content_hash"`
+	// RequestedAt is the scheduled capture instant; CapturedAt trails it by
+	// any wait for a concurrency slot.
+	RequestedAt time.Time `json:"requested_at"`
+	// FrameSetID is shared by frames of a camera group captured for the same
+	// aligned instant. Empty unless aligned polling is enabled.
+	FrameSetID string `json:"frame_set_id,omitempty"`
+	// DuplicateOf is the sequence of an earlier frame with identical
+	// content, for duplicates that are delivered marked rather than skipped.
+	DuplicateOf uint64 `json:"duplicate_of,omitempty"`
+	// IdempotencyKey identifies the frame across delivery attempts, so a
+	// target can recognize retries of a frame it already processed.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+func (m ImageMetadata) SetHeaders(h http.Header) {
+	h.Set(HeaderCameraID, m.CameraID)
+	h.Set(HeaderCaptureTime, m.CapturedAt.UTC().Format(time.RFC3339Nano))
+	h.Set(HeaderFetchLatency, m.FetchLatency.String())
+	h.Set(HeaderSequence, strconv.FormatUint(m.Sequence, 10))
+	if m.ContentHash != "" {
+		h.Set(HeaderContentHash, m.ContentHash)
+	}
+	if !m.RequestedAt.IsZero() {
+		h.Set(HeaderRequestTime, m.RequestedAt.UTC().Format(time.RFC3339Nano))
+	}
+	if m.FrameSetID != "" {
+		h.Set(HeaderFrameSetID, m.FrameSetID)
+	}
+	if m.DuplicateOf != 0 {
+		h.Set(HeaderDuplicateOf, strconv.FormatUint(m.DuplicateOf, 10))
+	}
+	if m.IdempotencyKey != "" {
+		h.Set(HeaderIdempotencyKey, m.IdempotencyKey)
+	}
+}
+
+// MetadataFromHeaders parses the metadata headers. Missing headers are left
+// at their zero value; malformed ones are an error.
+func MetadataFromHeaders(h http.Header) (ImageMetadata, error) {
+	meta := ImageMetadata{
+		CameraID:       h.Get(HeaderCameraID),
+		ContentHash:    h.Get(HeaderContentHash),
+		FrameSetID:     h.Get(HeaderFrameSetID),
+		IdempotencyKey: h.Get(HeaderIdempotencyKey),
+	}
+
+	var err error
+	if v := h.Get(HeaderCaptureTime); v != "" {
+		if meta.CapturedAt, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return meta, fmt.Errorf("invalid %s: %w", HeaderCaptureTime, err)
+		}
+	}
+	if v := h.Get(HeaderRequestTime); v != "" {
+		if meta.RequestedAt, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return meta, fmt.Errorf("invalid %s: %w", HeaderRequestTime, err)
+		}
+	}
+	if v := h.Get(HeaderFetchLatency); v != "" {
+		if meta.FetchLatency, err = time.ParseDuration(v); err != nil {
+			return meta, fmt.Errorf("invalid %s: %w", HeaderFetchLatency, err)
+		}
+	}
+	if v := h.Get(HeaderSequence); v != "" {
+		if meta.Sequence, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return meta, fmt.Errorf("invalid %s: %w", HeaderSequence, err)
+		}
+	}
+	if v := h.Get(HeaderDuplicateOf); v != "" {
+		if meta.DuplicateOf, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return meta, fmt.Errorf("invalid %s: %w", HeaderDuplicateOf, err)
+		}
+	}
+	return meta, nil
+}
@@ -0,0 +1,130 @@
+// Package logging builds the slog-backed loggers used by all services.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/interfaces"
+)
+
+// Field names shared by all services so log lines can be indexed consistently.
+const (
+	KeyService    = "service"
+	KeyCameraID   = "camera_id"
+	KeyDurationMS = "duration_ms"
+	KeyBytes      = "bytes"
+	KeyError      = "error"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+func New(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(format) {
+	case FormatText, "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want %s or %s)", format, FormatText, FormatJSON)
+	}
+}
+
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return level, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+	}
+	return level, nil
+}
+
+// FromEnv builds a logger for service writing to stdout, configured by
+// LOG_LEVEL (default info) and LOG_FORMAT (text or json, default text).
+func FromEnv(service string) (*slog.Logger, error) {
+	level := slog.LevelInfo
+	if s := os.Getenv("LOG_LEVEL"); s != "" {
+		var err error
+		if level, err = ParseLevel(s); err != nil {
+			return nil, err
+		}
+	}
+	logger, err := New(os.Stdout, os.Getenv("LOG_FORMAT"), level)
+	if err != nil {
+		return nil, err
+	}
+	return logger.With(KeyService, service), nil
+}
+
+// Printf adapts a structured logger for callers that still use Printf.
+// Every line is logged at info level.
+func Printf(logger interfaces.Logger) interfaces.PrintfLogger {
+	return printfAdapter{logger: logger}
+}
+
+type printfAdapter struct {
+	logger interfaces.Logger
+}
+
+func (a printfAdapter) Printf(format string, v ...interface{}) {
+	a.logger.Info(fmt.Sprintf(format, v...))
+}
+
+// FromPrintf adapts a printf-style logger such as *log.Logger. The level and
+// key/value pairs are rendered into the line.
+func FromPrintf(logger interfaces.PrintfLogger) interfaces.Logger {
+	return structuredAdapter{logger: logger}
+}
+
+type structuredAdapter struct {
+	logger interfaces.PrintfLogger
+}
+
+func (a structuredAdapter) Debug(msg string, args ...any) { a.log("DEBUG", msg, args) }
+func (a structuredAdapter) Info(msg string, args ...any)  { a.log("INFO", msg, args) }
+func (a structuredAdapter) Warn(msg string, args ...any)  { a.log("WARN", msg, args) }
+func (a structuredAdapter) Error(msg string, args ...any) { a.log("ERROR", msg, args) }
+
+func (a structuredAdapter) log(level, msg string, args []any) {
+	a.logger.Printf("%s", Format(level, msg, args...))
+}
+
+// Format renders a level, message and key/value pairs as a single line,
+// e.g. `WARN camera error camera_id=camera_1 error="timeout"`.
+func Format(level, msg string, args ...any) string {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteByte(' ')
+	b.WriteString(msg)
+
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(args...)
+	r.Attrs(func(attr slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%s", attr.Key, formatValue(attr.Value))
+		return true
+	})
+	return b.String()
+}
+
+func formatValue(v slog.Value) string {
+	s := v.Resolve().String()
+	if v.Kind() == slog.KindString || v.Kind() == slog.KindAny {
+		if s == "" || strings.ContainsAny(s, " \"=") {
+			return fmt.Sprintf("%q", s)
+		}
+	}
+	return s
+}
+
+// Fatal logs at error level and exits, like log.Fatalf.
+func Fatal(logger interfaces.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
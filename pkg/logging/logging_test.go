@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		level     string
+		expectErr bool
+		check     func(t *testing.T, out string)
+	}{
+		{
+			name:   "json with fields",
+			format: "json",
+			level:  "info",
+			check: func(t *testing.T, out string) {
+				var entry map[string]any
+				if err := json.Unmarshal([]byte(out), &entry); err != nil {
+					t.Fatalf("expected a JSON line, got %q: %v", out, err)
+				}
+				if entry["msg"] != "fetched image" || entry[KeyCameraID] != "camera_1" || entry[KeyBytes] != float64(512) {
+					t.Errorf("unexpected entry %v", entry)
+				}
+			},
+		},
+		{
+			name:   "text",
+			format: "text",
+			level:  "INFO",
+			check: func(t *testing.T, out string) {
+				if !strings.Contains(out, "level=INFO") || !strings.Contains(out, "camera_id=camera_1") {
+					t.Errorf("unexpected text output %q", out)
+				}
+			},
+		},
+		{
+			name:   "level filters info",
+			format: "json",
+			level:  "warn",
+			check: func(t *testing.T, out string) {
+				if out != "" {
+					t.Errorf("expected info line to be filtered, got %q", out)
+				}
+			},
+		},
+		{
+			name:      "unknown format",
+			format:    "xml",
+			level:     "info",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, err := ParseLevel(tt.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			logger, err := New(&buf, tt.format, level)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logger.Info("fetched image", KeyCameraID, "camera_1", KeyBytes, 512)
+			tt.check(t, strings.TrimSpace(buf.String()))
+		})
+	}
+}
+
+func TestParseLevelInvalid(t *testing.T) {
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	var buf bytes.Buffer
+	structured := FromPrintf(log.New(&buf, "", 0))
+	structured.Warn("camera error", KeyCameraID, "camera_2", KeyError, errors.New("connection refused"))
+
+	expected := `WARN camera error camera_id=camera_2 error="connection refused"` + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	logger, _ := New(&buf, FormatJSON, slog.LevelInfo)
+	Printf(logger).Printf("legacy line %d", 7)
+	if !strings.Contains(buf.String(), `"msg":"legacy line 7"`) || !strings.Contains(buf.String(), `"level":"INFO"`) {
+		t.Errorf("unexpected adapted output %q", buf.String())
+	}
+}
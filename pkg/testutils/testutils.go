@@ -2,12 +2,36 @@ package testutils
 
 import (
 	"fmt"
+	"sync"
+
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
 )
 
+// MockLogger records every line, e.g. "WARN camera error camera_id=camera_1".
 type MockLogger struct {
+	mu   sync.Mutex
 	Logs []string
 }
 
+func (m *MockLogger) Debug(msg string, args ...any) { m.append(logging.Format("DEBUG", msg, args...)) }
+func (m *MockLogger) Info(msg string, args ...any)  { m.append(logging.Format("INFO", msg, args...)) }
+func (m *MockLogger) Warn(msg string, args ...any)  { m.append(logging.Format("WARN", msg, args...)) }
+func (m *MockLogger) Error(msg string, args ...any) { m.append(logging.Format("ERROR", msg, args...)) }
+
 func (m *MockLogger) Printf(format string, v ...interface{}) {
-	m.Logs = append(m.Logs, fmt.Sprintf(format, v...))
+	m.append(fmt.Sprintf(format, v...))
+}
+
+// Snapshot returns a copy of the lines logged so far, safe to read while
+// other goroutines keep logging.
+func (m *MockLogger) Snapshot() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.Logs...)
+}
+
+func (m *MockLogger) append(line string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Logs = append(m.Logs, line)
 }
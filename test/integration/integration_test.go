@@ -11,12 +11,13 @@ import (
 	"github.com/akhilesharora/turnaround-collector/internal/camera"
 	"github.com/akhilesharora/turnaround-collector/internal/collector"
 	"github.com/akhilesharora/turnaround-collector/internal/target"
+	"github.com/akhilesharora/turnaround-collector/pkg/logging"
 )
 
 func TestIntegration(t *testing.T) {
-	cameraLogger := log.New(os.Stdout, "CAMERA: ", log.LstdFlags)
-	targetLogger := log.New(os.Stdout, "TARGET: ", log.LstdFlags)
-	collectorLogger := log.New(os.Stdout, "COLLECTOR: ", log.LstdFlags)
+	cameraLogger := logging.FromPrintf(log.New(os.Stdout, "CAMERA: ", log.LstdFlags))
+	targetLogger := logging.FromPrintf(log.New(os.Stdout, "TARGET: ", log.LstdFlags))
+	collectorLogger := logging.FromPrintf(log.New(os.Stdout, "COLLECTOR: ", log.LstdFlags))
 
 	// Start test servers
 	cameraServer := camera.NewServer(cameraLogger)
@@ -37,9 +38,11 @@ func TestIntegration(t *testing.T) {
 		TargetURL:     target.URL + "/image",
 	}
 
+	config.Cameras = collector.DefaultRegistry(config.CameraCount, config.CameraBaseURL)
+
 	httpClient := collector.NewClient(
 		5*time.Second,
-		config.CameraBaseURL,
+		config.Cameras,
 		config.TargetURL,
 	)
 